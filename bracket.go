@@ -0,0 +1,149 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// bracketPair returns the partner of the bracket c and
+// whether c is an open bracket.
+func bracketPair(c byte) (partner byte, open, ok bool) {
+	if i := strings.IndexByte(openBracketChars, c); i >= 0 {
+		return closeBracketChars[i], true, true
+	}
+	if i := strings.IndexByte(closeBracketChars, c); i >= 0 {
+		return openBracketChars[i], false, true
+	}
+	return 0, false, false
+}
+
+// findMatchingBracket returns the position of the bracket matching
+// the one at the byte offset of the line. Brackets drawn in a different
+// color (e.g. in strings or comments) by the highlight are ignored.
+func (m *Editor) findMatchingBracket(line, offset int) (position, bool) {
+	lineColors := m.lineColors()
+	colorAt := func(i, j int) readline.EscapeSequenceId {
+		if i < len(lineColors) && j < len(lineColors[i].maps) {
+			return lineColors[i].maps[j]
+		}
+		return 0
+	}
+	c := m.lines[line][offset]
+	partner, open, ok := bracketPair(c)
+	if !ok {
+		return position{}, false
+	}
+	color := colorAt(line, offset)
+	depth := 0
+	check := func(i, j int) bool {
+		s := m.lines[i]
+		if (s[j] != c && s[j] != partner) || colorAt(i, j) != color {
+			return false
+		}
+		if s[j] == c {
+			depth++
+			return false
+		}
+		depth--
+		return depth < 0
+	}
+	if open {
+		for i, j := line, offset+1; i < len(m.lines); i, j = i+1, 0 {
+			for ; j < len(m.lines[i]); j++ {
+				if check(i, j) {
+					return position{line: i, col: readline.MojiCountInString(m.lines[i][:j])}, true
+				}
+			}
+		}
+	} else {
+		for i, j := line, offset-1; i >= 0; i-- {
+			for ; j >= 0; j-- {
+				if check(i, j) {
+					return position{line: i, col: readline.MojiCountInString(m.lines[i][:j])}, true
+				}
+			}
+			if i > 0 {
+				j = len(m.lines[i-1]) - 1
+			}
+		}
+	}
+	return position{}, false
+}
+
+// bracketNearCursor returns the position of the bracket at the cursor,
+// or the one just before the cursor.
+func (m *Editor) bracketNearCursor() (position, bool) {
+	pos := m.cursorPosition()
+	if pos.line >= len(m.lines) {
+		return position{}, false
+	}
+	s := m.lines[pos.line]
+	if offset := mojiOffset(s, pos.col); offset < len(s) {
+		if _, _, ok := bracketPair(s[offset]); ok {
+			return pos, true
+		}
+	}
+	if pos.col > 0 {
+		offset := mojiOffset(s, pos.col-1)
+		if _, _, ok := bracketPair(s[offset]); ok {
+			return position{line: pos.line, col: pos.col - 1}, true
+		}
+	}
+	return position{}, false
+}
+
+// matchingBrackets returns the positions of the bracket near the cursor
+// and its partner to be drawn with MatchingBracketColor.
+func (m *Editor) matchingBrackets() []position {
+	if m.MatchingBracketColor == "" {
+		return nil
+	}
+	p, ok := m.bracketNearCursor()
+	if !ok {
+		return nil
+	}
+	q, ok := m.findMatchingBracket(p.line, mojiOffset(m.lines[p.line], p.col))
+	if !ok {
+		return nil
+	}
+	return []position{p, q}
+}
+
+// CmdForwardMatchingBracket moves the cursor after the bracket which closes
+// the one at the cursor (for Ctrl-Meta-F)
+func (m *Editor) CmdForwardMatchingBracket(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	pos := m.cursorPosition()
+	s := m.lines[pos.line]
+	if offset := mojiOffset(s, pos.col); offset < len(s) {
+		if _, open, ok := bracketPair(s[offset]); ok && open {
+			if q, ok := m.findMatchingBracket(pos.line, offset); ok {
+				q.col++
+				return m.moveCursorTo(b, q)
+			}
+		}
+	}
+	io.WriteString(b.Out, "\a")
+	return readline.CONTINUE
+}
+
+// CmdBackwardMatchingBracket moves the cursor to the bracket which opens
+// the one before the cursor (for Ctrl-Meta-B)
+func (m *Editor) CmdBackwardMatchingBracket(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	pos := m.cursorPosition()
+	if pos.col > 0 {
+		s := m.lines[pos.line]
+		offset := mojiOffset(s, pos.col-1)
+		if _, open, ok := bracketPair(s[offset]); ok && !open {
+			if q, ok := m.findMatchingBracket(pos.line, offset); ok {
+				return m.moveCursorTo(b, q)
+			}
+		}
+	}
+	io.WriteString(b.Out, "\a")
+	return readline.CONTINUE
+}
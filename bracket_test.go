@@ -0,0 +1,41 @@
+package multiline
+
+import (
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestMatchingBracketCommands(t *testing.T) {
+	keyin := strings.Split("(a\r(b)\rc)", "")
+	// Jump to the first `(` and insert `x`
+	keyin = append(keyin, keys.Escape+keys.CtrlB, "x")
+	// Jump after the last `)` and insert `y`
+	keyin = append(keyin, keys.Escape+keys.CtrlF, "y", keys.CtrlJ)
+
+	ed := Editor{MatchingBracketColor: "\x1B[4m"}
+	result := readWithKeys(t, &ed, keyin)
+	expect := "x(a\n(b)\nc)y"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestFindMatchingBracketSkipsStrings(t *testing.T) {
+	var ed Editor
+	ed.Highlight = []readline.Highlight{
+		{Pattern: regexp.MustCompile(`"[^"]*"`), Sequence: "\x1B[31m"},
+	}
+	ed.lines = []string{`f(")",`, `  x)`}
+	pos, ok := ed.findMatchingBracket(0, 1)
+	if !ok || pos != (position{line: 1, col: 3}) {
+		t.Fatalf("expect {1 3}, but %v (%v)", pos, ok)
+	}
+	pos, ok = ed.findMatchingBracket(1, 3)
+	if !ok || pos != (position{line: 0, col: 1}) {
+		t.Fatalf("expect {0 1}, but %v (%v)", pos, ok)
+	}
+}
@@ -0,0 +1,122 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// isCommentedOut tells whether all non-blank lines start with prefix
+// after the indentation.
+func isCommentedOut(lines []string, prefix string) bool {
+	prefix = strings.TrimRight(prefix, " \t")
+	found := false
+	for _, s := range lines {
+		s = strings.TrimLeft(s, " \t")
+		if s == "" {
+			continue
+		}
+		if !strings.HasPrefix(s, prefix) {
+			return false
+		}
+		found = true
+	}
+	return found
+}
+
+// toggleLineComment inserts prefix into the non-blank lines at the smallest
+// indentation of them, or removes it when all of them are commented out.
+func toggleLineComment(lines []string, prefix string) []string {
+	result := make([]string, len(lines))
+	if isCommentedOut(lines, prefix) {
+		trimmed := strings.TrimRight(prefix, " \t")
+		for i, s := range lines {
+			indent := leadingSpaces(s)
+			body := s[len(indent):]
+			if strings.HasPrefix(body, prefix) {
+				body = body[len(prefix):]
+			} else {
+				body = strings.TrimPrefix(body, trimmed)
+			}
+			result[i] = indent + body
+		}
+		return result
+	}
+	indent := ""
+	found := false
+	for _, s := range lines {
+		if strings.TrimSpace(s) == "" {
+			continue
+		}
+		if s1 := leadingSpaces(s); !found || len(s1) < len(indent) {
+			indent = s1
+			found = true
+		}
+	}
+	for i, s := range lines {
+		if strings.TrimSpace(s) == "" {
+			result[i] = s
+		} else {
+			result[i] = s[:len(indent)] + prefix + s[len(indent):]
+		}
+	}
+	return result
+}
+
+// toggleBlockComment encloses the lines with start and end,
+// or removes them when the lines are already enclosed.
+func toggleBlockComment(lines []string, start, end string) []string {
+	result := append([]string{}, lines...)
+	first := result[0]
+	indent := leadingSpaces(first)
+	last := len(result) - 1
+	if strings.HasPrefix(first[len(indent):], start) &&
+		strings.HasSuffix(strings.TrimRight(result[last], " \t"), end) {
+		body := strings.TrimPrefix(first[len(indent):], start)
+		if strings.HasPrefix(body, " ") {
+			body = body[1:]
+		}
+		result[0] = indent + body
+		s := strings.TrimRight(result[last], " \t")
+		s = strings.TrimSuffix(s, end)
+		result[last] = strings.TrimSuffix(s, " ")
+		return result
+	}
+	result[0] = indent + start + " " + first[len(indent):]
+	result[last] += " " + end
+	return result
+}
+
+// CmdToggleComment comments out the cursor line or the lines of the region
+// with LineComment (or BlockComment when LineComment is empty),
+// or uncomments them when they are already commented out (for Meta-;)
+func (m *Editor) CmdToggleComment(_ context.Context, b *readline.Buffer) readline.Result {
+	if m.LineComment == "" && (m.BlockComment[0] == "" || m.BlockComment[1] == "") {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.Sync(b.String())
+	first, last := m.lineRange()
+	m.keepRegion = true
+	m.shiftMoved = true
+	m.after = func(line string) bool {
+		m.Sync(line)
+		var block []string
+		if m.LineComment != "" {
+			block = toggleLineComment(m.lines[first:last+1], m.LineComment)
+		} else {
+			block = toggleBlockComment(m.lines[first:last+1], m.BlockComment[0], m.BlockComment[1])
+		}
+		lines := append([]string{}, m.lines...)
+		copy(lines[first:], block)
+
+		cursor := readline.MojiCountInString(m.lines[m.csrline])
+		cursor = m.LineEditor.Cursor + readline.MojiCountInString(lines[m.csrline]) - cursor
+		m.replaceLines(lines, m.csrline)
+		m.LineEditor.Cursor = max(cursor, 0)
+		return true
+	}
+	return readline.ENTER
+}
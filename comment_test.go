@@ -0,0 +1,45 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestToggleLineComment(t *testing.T) {
+	lines := []string{"SELECT *", "", "  FROM DUAL"}
+	commented := toggleLineComment(lines, "-- ")
+	expect := []string{"-- SELECT *", "", "--   FROM DUAL"}
+	if !equalLines(commented, expect) {
+		t.Fatalf("expect %#v, but %#v", expect, commented)
+	}
+	if result := toggleLineComment(commented, "-- "); !equalLines(result, lines) {
+		t.Fatalf("expect %#v, but %#v", lines, result)
+	}
+}
+
+func TestToggleBlockComment(t *testing.T) {
+	lines := []string{"  a = 1", "  b = 2"}
+	commented := toggleBlockComment(lines, "/*", "*/")
+	expect := []string{"  /* a = 1", "  b = 2 */"}
+	if !equalLines(commented, expect) {
+		t.Fatalf("expect %#v, but %#v", expect, commented)
+	}
+	if result := toggleBlockComment(commented, "/*", "*/"); !equalLines(result, lines) {
+		t.Fatalf("expect %#v, but %#v", lines, result)
+	}
+}
+
+func TestCmdToggleComment(t *testing.T) {
+	keyin := strings.Split("(a\r b)", "")
+	keyin = append(keyin, keys.Up, keys.CtrlA, keyShiftDown, keyShiftRight, keys.Escape+";")
+	keyin = append(keyin, keys.CtrlG, keys.Escape+";", keys.CtrlJ)
+
+	ed := Editor{LineComment: "; "}
+	result := readWithKeys(t, &ed, keyin)
+	expect := "; (a\n b)"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
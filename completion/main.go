@@ -9,6 +9,7 @@ import (
 	"github.com/nyaosorg/go-box/v3"
 	"github.com/nyaosorg/go-readline-ny"
 	singleCompletion "github.com/nyaosorg/go-readline-ny/completion"
+	"github.com/nyaosorg/go-readline-ny/keys"
 
 	"github.com/hymkor/go-multiline-ny"
 )
@@ -84,6 +85,62 @@ func lineToFields(line, quotes, del string) (fields []string) {
 	return
 }
 
+// lastFieldStart returns the index of the character in B where the field
+// before the cursor starts. It follows split of go-readline-ny/completion,
+// which is not exported, so that the menu replaces the same characters as
+// the completion of go-readline-ny. A delimiter just before the cursor is
+// the field by itself.
+func lastFieldStart(B *readline.Buffer, quotes, del string) (lastStart int) {
+	const spaces = " \t\r\n\v\f"
+	i := 0
+	for i < B.Cursor {
+		for strings.Contains(spaces, B.Buffer[i].String()) {
+			i++
+			if i >= B.Cursor {
+				return i
+			}
+		}
+		start := i
+		bits := 0
+		for {
+			c := B.Buffer[i].String()
+			if j := strings.Index(quotes, c); j >= 0 {
+				bits ^= (1 << j)
+			} else if bits == 0 {
+				if strings.Contains(spaces, c) {
+					lastStart = start
+					break
+				}
+				if strings.Contains(del, c) {
+					lastStart = i
+					i++
+					break
+				}
+			}
+			i++
+			if i >= B.Cursor {
+				return start
+			}
+		}
+	}
+	return lastStart
+}
+
+// matches returns the candidates starting with the field and the names listed for them.
+// When listingSet does not have a name for each candidate, the candidates are listed.
+func matches(completionSet, listingSet []string, field string) (newCompletionSet, newListingSet []string) {
+	if len(listingSet) != len(completionSet) {
+		listingSet = completionSet
+	}
+	for i, name := range completionSet {
+		if len(name) >= len(field) && strings.EqualFold(field, name[:len(field)]) {
+			newCompletionSet = append(newCompletionSet, name)
+			newListingSet = append(newListingSet, listingSet[i])
+		}
+	}
+	return
+}
+
 func (C *CmdCompletionOrList) Call(ctx context.Context, B *readline.Buffer) readline.Result {
 	fieldsBeforeCurrentLine := []string{}
 	for _, line := range C.editor.Lines()[:C.editor.CursorLine()] {
@@ -91,21 +148,56 @@ func (C *CmdCompletionOrList) Call(ctx context.Context, B *readline.Buffer) read
 		fieldsBeforeCurrentLine = append(fieldsBeforeCurrentLine, f...)
 	}
 
+	var completionSet, listingSet []string
+	var field string
 	newCandidates := func(fieldsBeforeCursor []string) ([]string, []string) {
 		f := make([]string, 0, len(fieldsBeforeCurrentLine)+len(fieldsBeforeCursor))
 		f = append(f, fieldsBeforeCurrentLine...)
 		f = append(f, fieldsBeforeCursor...)
 		if C.CandidatesContext != nil {
-			return C.CandidatesContext(ctx, f)
+			completionSet, listingSet = C.CandidatesContext(ctx, f)
+		} else {
+			completionSet, listingSet = C.Candidates(f)
 		}
-		return C.Candidates(f)
+		if len(listingSet) != len(completionSet) {
+			// go-readline-ny indexes listingSet as completionSet
+			listingSet = nil
+		}
+		field = fieldsBeforeCursor[len(fieldsBeforeCursor)-1]
+		return completionSet, listingSet
 	}
 	list := singleCompletion.Complete(C.Enclosure, C.Delimiter, B, newCandidates, C.Postfix)
 	if len(list) <= 0 {
 		return readline.CONTINUE
 	}
-	// listing
 	m := C.editor
+
+	// select one of the candidates in the menu
+	completionSet, listingSet = matches(completionSet, listingSet, field)
+	start := lastFieldStart(B, C.Enclosure, C.Delimiter)
+	selected, key := m.PopupMenu(B, listingSet, start)
+	if selected >= 0 {
+		str := completionSet[selected]
+		if len(C.Enclosure) > 0 && len(C.Delimiter) > 0 && strings.ContainsAny(str, " \t\r\n\v\f"+C.Delimiter) {
+			q := C.Enclosure[:1]
+			if start < len(B.Buffer) {
+				if qq := B.Buffer[start].String(); strings.Contains(C.Enclosure, qq) {
+					q = qq
+				}
+			}
+			str = q + str + q
+		}
+		B.ReplaceAndRepaint(start, str+C.Postfix)
+		return readline.CONTINUE
+	}
+	if key == keys.Escape || key == keys.CtrlG {
+		return readline.CONTINUE
+	} else if key != "" {
+		// The key which closed the menu works as usual.
+		return m.LineEditor.LookupCommand(key).Call(ctx, B)
+	}
+
+	// listing when there is no room for the menu
 	m.SetNextEditHook(func(line string) bool {
 		m.GotoEndLine()
 
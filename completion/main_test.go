@@ -1,8 +1,16 @@
 package completion
 
 import (
+	"context"
+	"fmt"
+	"io"
 	"strings"
 	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+
+	"github.com/hymkor/go-multiline-ny"
 )
 
 func eq(a, b []string) bool {
@@ -32,3 +40,112 @@ func TestLineToFields(t *testing.T) {
 		}
 	}
 }
+
+func TestMatches(t *testing.T) {
+	completionSet := []string{"select", "set", "delete"}
+	for _, listingSet := range [][]string{nil, {"select"}, {"select", "set", "delete", "x"}} {
+		c, l := matches(completionSet, listingSet, "se")
+		if !eq(c, []string{"select", "set"}) || !eq(l, c) {
+			t.Fatalf("%#v: expect select|set, but %#v and %#v", listingSet, c, l)
+		}
+	}
+	c, l := matches(completionSet, []string{"SELECT", "SET", "DELETE"}, "se")
+	if !eq(c, []string{"select", "set"}) || !eq(l, []string{"SELECT", "SET"}) {
+		t.Fatalf("expect SELECT|SET, but %#v and %#v", c, l)
+	}
+}
+
+func TestCompletionMenu(t *testing.T) {
+	candidates := func(fields []string) ([]string, []string) {
+		return []string{"select", "selfish", "sex", "set x"}, nil
+	}
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		{[]string{"s", "e", keys.CtrlI, keys.CtrlM, keys.CtrlJ}, "select "},
+		{[]string{"s", "e", keys.CtrlI, keys.CtrlI, keys.CtrlM, keys.CtrlJ}, "selfish "},
+		{[]string{"s", "e", keys.CtrlI, keys.ShiftTab, keys.CtrlM, keys.CtrlJ}, `"set x" `},
+		{[]string{"s", "e", keys.CtrlI, keys.Down, keys.Down, keys.Up, keys.CtrlM, keys.CtrlJ}, "selfish "},
+		{[]string{"s", "e", keys.CtrlI, "l", keys.CtrlJ}, "sel"},
+		{[]string{"s", "e", keys.CtrlI, keys.CtrlG, keys.CtrlJ}, "se"},
+		{[]string{"s", "e", keys.CtrlI, keys.CtrlJ}, "se"},
+		{[]string{"a", keys.CtrlM, "s", "e", keys.CtrlI, keys.CtrlI, keys.CtrlM, keys.CtrlJ}, "a\nselfish "},
+	} {
+		var ed multiline.Editor
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		ed.BindKey(keys.CtrlI, &CmdCompletionOrList{
+			Delimiter:  "&|><;",
+			Enclosure:  `"'`,
+			Postfix:    " ",
+			Candidates: candidates,
+		})
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
+
+func TestCompletionMenuWithShortListingSet(t *testing.T) {
+	var ed multiline.Editor
+	ed.LineEditor.Tty = &auto.Pilot{Text: []string{"s", "e", keys.CtrlI, keys.CtrlI, keys.CtrlM, keys.CtrlJ}}
+	ed.SetWriter(io.Discard)
+	ed.BindKey(keys.CtrlI, &CmdCompletionOrList{
+		Postfix: " ",
+		Candidates: func([]string) ([]string, []string) {
+			return []string{"select", "selfish", "sex"}, []string{"SELECT"}
+		},
+	})
+	lines, err := ed.Read(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result := strings.Join(lines, "\n"); result != "selfish " {
+		t.Fatalf("expect %#v, but %#v", "selfish ", result)
+	}
+}
+
+func completeWith(t *testing.T, keyin []string, count int) string {
+	t.Helper()
+	var ed multiline.Editor
+	ed.LineEditor.Tty = &auto.Pilot{Text: keyin}
+	ed.SetWriter(io.Discard)
+	ed.BindKey(keys.CtrlI, &CmdCompletionOrList{
+		Delimiter: "&|><;",
+		Enclosure: `"'`,
+		Postfix:   " ",
+		Candidates: func(fields []string) ([]string, []string) {
+			field := fields[len(fields)-1]
+			var candidates []string
+			for i := 1; i <= count; i++ {
+				candidates = append(candidates, fmt.Sprintf("%s%d", field, i))
+			}
+			return candidates, nil
+		},
+	})
+	lines, err := ed.Read(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestLastFieldStart(t *testing.T) {
+	// The menu has to replace the same characters as go-readline-ny
+	// replaces with the only candidate.
+	for _, source := range []string{
+		`ab`, `x ab`, `x  `, `x&ab`, `x&`, `x& `, `x&&`, `x "a b`, `"a&b`, `x "a b" c`, `x 'a"b`, `x"a b"&`,
+	} {
+		keyin := strings.Split(source, "")
+		expect := completeWith(t, append(keyin, keys.CtrlI, keys.CtrlJ), 1)
+		result := completeWith(t, append(keyin, keys.CtrlI, keys.CtrlM, keys.CtrlJ), 2)
+		if result != expect {
+			t.Fatalf("%#v: expect %#v, but %#v", source, expect, result)
+		}
+	}
+}
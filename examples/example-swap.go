@@ -38,6 +38,8 @@ func main() {
 		fmt.Println("-----")
 		fmt.Println(L)
 		fmt.Println("-----")
-		history.Add(L)
+		if err := ed.AddHistory(lines); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
 	}
 }
@@ -86,6 +86,11 @@ func main() {
 	history := simplehistory.New()
 	ed.SetHistory(history)
 	ed.SetHistoryCycling(true)
+	ed.HistoryPolicy = multiline.HistoryPolicy{
+		IgnoreDups:        true,
+		IgnoreSpace:       true,
+		TrimTrailingSpace: true,
+	}
 
 	// enable completion (optional)
 	ed.BindKey(keys.CtrlI, &completion.CmdCompletionOrList{
@@ -116,6 +121,8 @@ func main() {
 		fmt.Println("-----")
 		fmt.Println(L)
 		fmt.Println("-----")
-		history.Add(L)
+		if err := ed.AddHistory(lines); err != nil {
+			fmt.Fprintln(os.Stderr, err.Error())
+		}
 	}
 }
@@ -9,11 +9,11 @@ require (
 	github.com/nyaosorg/go-box/v3 v3.0.0
 	github.com/nyaosorg/go-readline-ny v1.14.3
 	github.com/nyaosorg/go-ttyadapter v0.3.0
+	golang.org/x/sys v0.30.0
 )
 
 require (
 	github.com/clipperhouse/uax29/v2 v2.2.0 // indirect
 	github.com/mattn/go-isatty v0.0.20 // indirect
 	github.com/mattn/go-tty v0.0.7 // indirect
-	golang.org/x/sys v0.30.0 // indirect
 )
@@ -0,0 +1,279 @@
+package multiline
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+	"unicode"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// HistoryEntry is an entry of the history with its information.
+type HistoryEntry struct {
+	Text    string
+	Time    time.Time // when the entry was submitted
+	Dir     string    // the working directory where the entry was submitted
+	Tags    []string  // the tags defined by the application (e.g. the name of the connection)
+	Success bool      // the entry was executed successfully
+}
+
+// HasTag returns true when the entry has tag.
+func (e HistoryEntry) HasTag(tag string) bool {
+	for _, t := range e.Tags {
+		if t == tag {
+			return true
+		}
+	}
+	return false
+}
+
+// RichHistory is the history which has the information of the entries.
+// When LineEditor.History implements it, HistoryFilter receives
+// the entries returned by EntryAt.
+type RichHistory interface {
+	readline.IHistory
+	EntryAt(int) HistoryEntry
+}
+
+// RecordingHistory is the history which records the information of
+// the entries added. When LineEditor.History implements it,
+// AddHistory and AddHistoryEntry call AddEntry instead of Add.
+type RecordingHistory interface {
+	readline.IHistory
+	AddEntry(HistoryEntry) error
+}
+
+// EditableHistory is the history whose entries can be changed in Editor.
+// When LineEditor.History implements it, the displayed entry can be removed,
+// replaced with the edited lines and pinned. The pinned entries are accepted
+// regardless of HistoryFilter and listed first by the history picker.
+type EditableHistory interface {
+	readline.IHistory
+	Remove(i int) error
+	Replace(i int, entry string) error
+	Pin(i int, pinned bool) error
+	Pinned(i int) bool
+}
+
+// historyEntry returns the i-th entry of the history.
+func (m *Editor) historyEntry(i int) HistoryEntry {
+	h := m.LineEditor.History
+	if rich, ok := h.(RichHistory); ok {
+		return rich.EntryAt(i)
+	}
+	return HistoryEntry{Text: h.At(i)}
+}
+
+// historyPinned returns true when the i-th entry of the history is pinned.
+func (m *Editor) historyPinned(i int) bool {
+	h, ok := m.LineEditor.History.(EditableHistory)
+	return ok && h.Pinned(i)
+}
+
+// acceptsHistory returns true when HistoryFilter accepts the i-th entry of
+// the history or it is pinned.
+func (m *Editor) acceptsHistory(i int) bool {
+	return m.HistoryFilter == nil || m.historyPinned(i) || m.HistoryFilter(m.historyEntry(i))
+}
+
+// previousHistory returns the index of the entry accepted by HistoryFilter
+// before the i-th entry. When it is not found, it returns -1.
+func (m *Editor) previousHistory(i int) int {
+	for i--; i >= 0; i-- {
+		if m.acceptsHistory(i) {
+			return i
+		}
+	}
+	return -1
+}
+
+// nextHistory returns the index of the entry accepted by HistoryFilter
+// after the i-th entry. When it is not found, it returns the count of the history
+// which means the lines being edited.
+func (m *Editor) nextHistory(i int) int {
+	n := m.LineEditor.History.Len()
+	for i++; i < n; i++ {
+		if m.acceptsHistory(i) {
+			return i
+		}
+	}
+	return n
+}
+
+// editableHistory returns the history when the displayed entry can be changed.
+func (m *Editor) editableHistory() (EditableHistory, bool) {
+	h, ok := m.LineEditor.History.(EditableHistory)
+	return h, ok && m.historyPtr < h.Len()
+}
+
+// showMessageAfter shows msg after the command is finished.
+func (m *Editor) showMessageAfter(b *readline.Buffer, msg string) readline.Result {
+	cursor := b.Cursor
+	m.after = func(line string) bool {
+		m.Sync(line)
+		m.showMessage(msg)
+		m.LineEditor.Cursor = cursor
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdRemoveHistory removes the displayed entry from the history and shows
+// the next one (for Ctrl-X Ctrl-D)
+func (m *Editor) CmdRemoveHistory(_ context.Context, b *readline.Buffer) readline.Result {
+	h, ok := m.editableHistory()
+	if !ok {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	if err := h.Remove(m.historyPtr); err != nil {
+		return m.showMessageAfter(b, err.Error())
+	}
+	// The entries after the removed one move forward.
+	modified := make(map[int]string, len(m.modifiedHistoryEntry))
+	for i, value := range m.modifiedHistoryEntry {
+		if i > m.historyPtr {
+			modified[i-1] = value
+		} else if i < m.historyPtr {
+			modified[i] = value
+		}
+	}
+	m.modifiedHistoryEntry = modified
+	m.after = m.printCurrentHistoryRecord
+	return readline.ENTER
+}
+
+// CmdSaveHistory replaces the displayed entry of the history with
+// the edited lines (for Ctrl-X Ctrl-S)
+func (m *Editor) CmdSaveHistory(ctx context.Context, b *readline.Buffer) readline.Result {
+	h, ok := m.editableHistory()
+	if !ok {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.saveModfiedHistory(b)
+	value, ok := m.modifiedHistoryEntry[m.historyPtr]
+	if !ok {
+		return readline.CONTINUE
+	}
+	if value == "" {
+		return m.CmdRemoveHistory(ctx, b)
+	}
+	if err := h.Replace(m.historyPtr, value); err != nil {
+		return m.showMessageAfter(b, err.Error())
+	}
+	delete(m.modifiedHistoryEntry, m.historyPtr)
+	return m.showMessageAfter(b, "saved into the history")
+}
+
+// CmdTogglePinHistory pins the displayed entry of the history or unpins it
+// (for Ctrl-X Ctrl-P)
+func (m *Editor) CmdTogglePinHistory(_ context.Context, b *readline.Buffer) readline.Result {
+	h, ok := m.editableHistory()
+	if !ok {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	pinned := !h.Pinned(m.historyPtr)
+	if err := h.Pin(m.historyPtr, pinned); err != nil {
+		return m.showMessageAfter(b, err.Error())
+	}
+	if pinned {
+		return m.showMessageAfter(b, "pinned")
+	}
+	return m.showMessageAfter(b, "unpinned")
+}
+
+// HistoryPolicy tells which entries AddHistory and AddHistoryEntry add to the history.
+// The entries consisting of white spaces are always ignored.
+type HistoryPolicy struct {
+	IgnoreDups        bool           // ignore the entry equal to the newest one
+	EraseDups         bool           // remove the older entries equal to the new one (ignore the new one without EditableHistory)
+	IgnoreSpace       bool           // ignore the entry starting with a space
+	IgnorePattern     *regexp.Regexp // ignore the entry matching it
+	TrimTrailingSpace bool           // remove the white spaces at the end of each line
+}
+
+// normalize returns the entry to be added instead of entry.
+func (p *HistoryPolicy) normalize(entry string) string {
+	if !p.TrimTrailingSpace {
+		return entry
+	}
+	lines := strings.Split(entry, "\n")
+	for i, line := range lines {
+		lines[i] = strings.TrimRightFunc(line, unicode.IsSpace)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// ignores returns true when entry should not be added to h.
+func (p *HistoryPolicy) ignores(h readline.IHistory, entry string) bool {
+	if strings.TrimSpace(entry) == "" {
+		return true
+	}
+	if p.IgnoreSpace && strings.HasPrefix(entry, " ") {
+		return true
+	}
+	if p.IgnorePattern != nil && p.IgnorePattern.MatchString(entry) {
+		return true
+	}
+	return p.IgnoreDups && h.Len() > 0 && h.At(h.Len()-1) == entry
+}
+
+// AddHistory adds lines returned by Read to LineEditor.History following
+// HistoryPolicy with the current time and working directory.
+// To record Tags and Success, use AddHistoryEntry instead.
+func (m *Editor) AddHistory(lines []string) error {
+	dir, _ := os.Getwd()
+	return m.AddHistoryEntry(HistoryEntry{
+		Text: strings.Join(lines, "\n"),
+		Time: time.Now(),
+		Dir:  dir,
+	})
+}
+
+// AddHistoryEntry adds e to LineEditor.History following HistoryPolicy.
+// When the history implements RecordingHistory, the information of e is
+// recorded with it. Otherwise the history must have the method Add(string)
+// or Add(string) error, and only e.Text is added.
+func (m *Editor) AddHistoryEntry(e HistoryEntry) error {
+	h := m.LineEditor.History
+	if h == nil {
+		return errors.New("multiline: History is not set")
+	}
+	entry := m.HistoryPolicy.normalize(e.Text)
+	if m.HistoryPolicy.ignores(h, entry) {
+		return nil
+	}
+	e.Text = entry
+	if m.HistoryPolicy.EraseDups {
+		editable, ok := h.(EditableHistory)
+		for i := h.Len() - 1; i >= 0; i-- {
+			if h.At(i) != entry {
+				continue
+			}
+			if !ok {
+				// The older entry can not be removed.
+				return nil
+			}
+			if err := editable.Remove(i); err != nil {
+				return err
+			}
+		}
+	}
+	switch h := h.(type) {
+	case RecordingHistory:
+		return h.AddEntry(e)
+	case interface{ Add(string) error }:
+		return h.Add(entry)
+	case interface{ Add(string) }:
+		h.Add(entry)
+		return nil
+	}
+	return errors.New("multiline: History has no method Add")
+}
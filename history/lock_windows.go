@@ -0,0 +1,21 @@
+//go:build windows
+
+package history
+
+import (
+	"os"
+
+	"golang.org/x/sys/windows"
+)
+
+func lock(fd *os.File, exclusive bool) error {
+	var flags uint32
+	if exclusive {
+		flags = windows.LOCKFILE_EXCLUSIVE_LOCK
+	}
+	return windows.LockFileEx(windows.Handle(fd.Fd()), flags, 0, 1, 0, &windows.Overlapped{})
+}
+
+func unlock(fd *os.File) error {
+	return windows.UnlockFileEx(windows.Handle(fd.Fd()), 0, 1, 0, &windows.Overlapped{})
+}
@@ -0,0 +1,436 @@
+// Package history provides the history of go-multiline-ny stored in a file.
+// It implements readline.IHistory, and the entries may contain newlines.
+//
+// Each entry is saved in one line of the file escaping backslashes and
+// newlines, and it is appended with the file locked, so that several
+// processes can share one history file. The line of a pinned entry
+// starts with `\p`. The line of an entry added with its information by
+// AddEntry is `\m` followed by the JSON of them.
+package history
+
+import (
+	"bufio"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/hymkor/go-multiline-ny"
+)
+
+const defaultMaxSize = 1000
+
+// File is the history stored in the file.
+// The entries are loaded when they are referred first.
+// The entries added by the other processes after loading are not read
+// until the next instance is made.
+type File struct {
+	path    string
+	loaded  bool
+	entries []string
+	pinned  map[string]bool
+	info    map[string]multiline.HistoryEntry
+
+	// MaxSize is the maximum count of the entries except for the pinned ones.
+	// When it is zero, 1000 is used.
+	MaxSize int
+}
+
+// New returns the history stored in the file at path.
+// The file is not read until the entries are referred.
+func New(path string) *File {
+	return &File{path: path}
+}
+
+func (f *File) maxSize() int {
+	if f.MaxSize <= 0 {
+		return defaultMaxSize
+	}
+	return f.MaxSize
+}
+
+// escape converts entry into one line.
+func escape(entry string) string {
+	var buffer strings.Builder
+	for _, c := range entry {
+		switch c {
+		case '\\':
+			buffer.WriteString(`\\`)
+		case '\n':
+			buffer.WriteString(`\n`)
+		case '\r':
+			buffer.WriteString(`\r`)
+		default:
+			buffer.WriteRune(c)
+		}
+	}
+	return buffer.String()
+}
+
+// pinMark is the prefix of the line of a pinned entry, and infoMark is
+// the one of the entry with its information. escape never makes a line
+// starting with them.
+const (
+	pinMark  = `\p`
+	infoMark = `\m`
+)
+
+// record is the JSON of the entry with its information.
+type record struct {
+	Text    string    `json:"text"`
+	Time    time.Time `json:"time"`
+	Dir     string    `json:"dir,omitempty"`
+	Tags    []string  `json:"tags,omitempty"`
+	Success bool      `json:"success,omitempty"`
+}
+
+func hasInfo(e multiline.HistoryEntry) bool {
+	return !e.Time.IsZero() || e.Dir != "" || len(e.Tags) > 0 || e.Success
+}
+
+// setInfo keeps the information of e in info.
+func setInfo(info map[string]multiline.HistoryEntry, e multiline.HistoryEntry) {
+	if hasInfo(e) {
+		info[e.Text] = e
+	} else {
+		delete(info, e.Text)
+	}
+}
+
+// entryOf returns the entry with the information in info.
+func entryOf(info map[string]multiline.HistoryEntry, entry string) multiline.HistoryEntry {
+	if e, ok := info[entry]; ok {
+		return e
+	}
+	return multiline.HistoryEntry{Text: entry}
+}
+
+func format(e multiline.HistoryEntry, pinned bool) string {
+	line := escape(e.Text)
+	if hasInfo(e) {
+		if data, err := json.Marshal(record(e)); err == nil {
+			line = infoMark + string(data)
+		}
+	}
+	if pinned {
+		return pinMark + line
+	}
+	return line
+}
+
+// parse returns the entry of the line written by format
+// and whether it is pinned.
+func parse(line string) (multiline.HistoryEntry, bool) {
+	pinned := strings.HasPrefix(line, pinMark)
+	if pinned {
+		line = line[len(pinMark):]
+	}
+	if strings.HasPrefix(line, infoMark) {
+		var r record
+		if err := json.Unmarshal([]byte(line[len(infoMark):]), &r); err == nil {
+			return multiline.HistoryEntry(r), pinned
+		}
+	}
+	return multiline.HistoryEntry{Text: unescape(line)}, pinned
+}
+
+// unescape restores the entry converted by escape.
+func unescape(line string) string {
+	var buffer strings.Builder
+	escaped := false
+	for _, c := range line {
+		if escaped {
+			switch c {
+			case 'n':
+				buffer.WriteByte('\n')
+			case 'r':
+				buffer.WriteByte('\r')
+			default:
+				buffer.WriteRune(c)
+			}
+			escaped = false
+		} else if c == '\\' {
+			escaped = true
+		} else {
+			buffer.WriteRune(c)
+		}
+	}
+	return buffer.String()
+}
+
+// compact removes the older duplicates of the entries
+// and the oldest entries over max except for the pinned ones.
+func compact(entries []string, pinned map[string]bool, max int) []string {
+	seen := make(map[string]struct{}, len(entries))
+	result := make([]string, 0, len(entries))
+	count := 0
+	for i := len(entries) - 1; i >= 0; i-- {
+		if _, ok := seen[entries[i]]; ok {
+			continue
+		}
+		seen[entries[i]] = struct{}{}
+		if !pinned[entries[i]] {
+			if count >= max {
+				continue
+			}
+			count++
+		}
+		result = append(result, entries[i])
+	}
+	for i, j := 0, len(result)-1; i < j; i, j = i+1, j-1 {
+		result[i], result[j] = result[j], result[i]
+	}
+	return result
+}
+
+// readEntries returns the entries in r, the set of the pinned ones
+// and the information of the newest ones of them.
+func readEntries(r io.Reader) ([]string, map[string]bool, map[string]multiline.HistoryEntry, error) {
+	var entries []string
+	pinned := map[string]bool{}
+	info := map[string]multiline.HistoryEntry{}
+	sc := bufio.NewScanner(r)
+	sc.Buffer(make([]byte, 0, 4096), 64*1024*1024)
+	for sc.Scan() {
+		line := strings.TrimSuffix(sc.Text(), "\r")
+		if line == "" {
+			continue
+		}
+		e, isPinned := parse(line)
+		if isPinned {
+			pinned[e.Text] = true
+		}
+		setInfo(info, e)
+		entries = append(entries, e.Text)
+	}
+	return entries, pinned, info, sc.Err()
+}
+
+// Load reads the entries from the file unless they are loaded already.
+// Len and At call it and ignore its error.
+// When the file does not exist, the history is empty.
+func (f *File) Load() error {
+	if f.loaded {
+		return nil
+	}
+	f.loaded = true
+	f.pinned = map[string]bool{}
+	f.info = map[string]multiline.HistoryEntry{}
+	fd, err := os.Open(f.path)
+	if err != nil {
+		if errors.Is(err, fs.ErrNotExist) {
+			return nil
+		}
+		return fmt.Errorf("history: %w", err)
+	}
+	defer fd.Close()
+	if err := lock(fd, false); err != nil {
+		return fmt.Errorf("history: lock %s: %w", f.path, err)
+	}
+	defer unlock(fd)
+	entries, pinned, info, err := readEntries(fd)
+	f.entries = compact(entries, pinned, f.maxSize())
+	f.pinned = pinned
+	f.info = info
+	if err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// Len returns the count of the entries.
+func (f *File) Len() int {
+	f.Load()
+	return len(f.entries)
+}
+
+// At returns the i-th entry. The oldest entry is At(0).
+func (f *File) At(i int) string {
+	f.Load()
+	return f.entries[i]
+}
+
+// EntryAt returns the i-th entry with the information added by AddEntry.
+func (f *File) EntryAt(i int) multiline.HistoryEntry {
+	f.Load()
+	return entryOf(f.info, f.entries[i])
+}
+
+// Add appends entry to the history and the file.
+// The older entries equal to it are removed, and an empty entry is ignored.
+// When the file has too many lines, it is rewritten without
+// the duplicates and the oldest entries over MaxSize.
+func (f *File) Add(entry string) error {
+	return f.AddEntry(multiline.HistoryEntry{Text: entry})
+}
+
+// AddEntry appends e.Text to the history and the file as Add does,
+// and records the information of e with it.
+func (f *File) AddEntry(e multiline.HistoryEntry) error {
+	entry := e.Text
+	if entry == "" {
+		return nil
+	}
+	f.Load()
+	max := f.maxSize()
+	f.entries = compact(append(f.entries, entry), f.pinned, max)
+	setInfo(f.info, e)
+
+	return f.update(func(fd *os.File, entries []string, pinned map[string]bool, info map[string]multiline.HistoryEntry) ([]string, error) {
+		if len(entries) < 2*max {
+			if _, err := fd.Seek(0, io.SeekEnd); err != nil {
+				return nil, err
+			}
+			_, err := io.WriteString(fd, format(e, f.pinned[entry])+"\n")
+			return nil, err
+		}
+		setInfo(info, e)
+		// The entries of the other processes are kept.
+		return append(entries, entry), nil
+	})
+}
+
+// update calls change with the entries in the file locked.
+// When change returns the entries, the file is rewritten into them
+// without the duplicates and the oldest entries over MaxSize.
+func (f *File) update(change func(fd *os.File, entries []string, pinned map[string]bool, info map[string]multiline.HistoryEntry) ([]string, error)) error {
+	fd, err := os.OpenFile(f.path, os.O_RDWR|os.O_CREATE, 0600)
+	if err != nil {
+		return fmt.Errorf("history: %w", err)
+	}
+	defer fd.Close()
+	if err := lock(fd, true); err != nil {
+		return fmt.Errorf("history: lock %s: %w", f.path, err)
+	}
+	defer unlock(fd)
+
+	entries, pinned, info, err := readEntries(fd)
+	if err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	entries, err = change(fd, entries, pinned, info)
+	if err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	if entries == nil {
+		return nil
+	}
+	entries = compact(entries, pinned, f.maxSize())
+	if err := fd.Truncate(0); err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	if _, err := fd.Seek(0, io.SeekStart); err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	w := bufio.NewWriter(fd)
+	for _, e := range entries {
+		w.WriteString(format(entryOf(info, e), pinned[e]))
+		w.WriteByte('\n')
+	}
+	if err := w.Flush(); err != nil {
+		return fmt.Errorf("history: %s: %w", f.path, err)
+	}
+	return nil
+}
+
+// replaceEntry returns entries whose elements equal to old are replaced with
+// the new one. When new is empty, they are removed.
+func replaceEntry(entries []string, old, new string) []string {
+	result := make([]string, 0, len(entries))
+	for _, e := range entries {
+		if e != old {
+			result = append(result, e)
+		} else if new != "" {
+			result = append(result, new)
+		}
+	}
+	return result
+}
+
+// Remove removes the i-th entry from the history and the file.
+// The entries equal to it which the other processes added are also removed.
+func (f *File) Remove(i int) error {
+	return f.Replace(i, "")
+}
+
+// replaceInfo moves the information of old to new.
+// When new is empty, it is removed.
+func replaceInfo(info map[string]multiline.HistoryEntry, old, new string) {
+	e, ok := info[old]
+	delete(info, old)
+	if ok && new != "" {
+		e.Text = new
+		info[new] = e
+	}
+}
+
+// Replace replaces the i-th entry with entry in the history and the file.
+// The information of the entry is kept.
+// When entry is empty, the i-th entry is removed.
+func (f *File) Replace(i int, entry string) error {
+	f.Load()
+	old := f.entries[i]
+	err := f.update(func(_ *os.File, entries []string, pinned map[string]bool, info map[string]multiline.HistoryEntry) ([]string, error) {
+		if entry != "" && pinned[old] {
+			pinned[entry] = true
+		}
+		delete(pinned, old)
+		replaceInfo(info, old, entry)
+		return replaceEntry(entries, old, entry), nil
+	})
+	if err != nil {
+		return err
+	}
+	if entry != "" && f.pinned[old] {
+		f.pinned[entry] = true
+	}
+	delete(f.pinned, old)
+	replaceInfo(f.info, old, entry)
+	if entry == "" {
+		f.entries = append(f.entries[:i:i], f.entries[i+1:]...)
+	} else {
+		f.entries[i] = entry
+	}
+	return nil
+}
+
+// Pin sets whether the i-th entry is pinned. The pinned entries are not
+// removed even when the count of the entries exceeds MaxSize.
+func (f *File) Pin(i int, pinned bool) error {
+	f.Load()
+	entry := f.entries[i]
+	err := f.update(func(_ *os.File, entries []string, pinnedInFile map[string]bool, info map[string]multiline.HistoryEntry) ([]string, error) {
+		if !pinned {
+			delete(pinnedInFile, entry)
+			return entries, nil
+		}
+		pinnedInFile[entry] = true
+		for _, e := range entries {
+			if e == entry {
+				return entries, nil
+			}
+		}
+		// The entry was removed from the file by the other process.
+		setInfo(info, f.EntryAt(i))
+		return append(entries, entry), nil
+	})
+	if err != nil {
+		return err
+	}
+	if pinned {
+		f.pinned[entry] = true
+	} else {
+		delete(f.pinned, entry)
+	}
+	return nil
+}
+
+// Pinned returns true when the i-th entry is pinned.
+func (f *File) Pinned(i int) bool {
+	f.Load()
+	return f.pinned[f.entries[i]]
+}
@@ -0,0 +1,192 @@
+package history
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/hymkor/go-multiline-ny"
+)
+
+var (
+	_ multiline.RichHistory      = (*File)(nil)
+	_ multiline.RecordingHistory = (*File)(nil)
+	_ multiline.EditableHistory  = (*File)(nil)
+)
+
+func entriesOf(f *File) []string {
+	result := make([]string, f.Len())
+	for i := range result {
+		result[i] = f.At(i)
+	}
+	return result
+}
+
+func TestEscape(t *testing.T) {
+	for _, entry := range []string{
+		"select *\nfrom emp",
+		`a\nb`,
+		"a\\\nb\r\n",
+		"\\",
+	} {
+		line := escape(entry)
+		if strings.ContainsAny(line, "\r\n") {
+			t.Fatalf("%#v contains a newline", line)
+		}
+		if result := unescape(line); result != entry {
+			t.Fatalf("expect %#v, but %#v", entry, result)
+		}
+	}
+}
+
+func TestAddAndLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := New(path)
+	if h.Len() != 0 {
+		t.Fatalf("history of a missing file has %d entries", h.Len())
+	}
+	for _, entry := range []string{"select *\nfrom emp;", "a\\nb", "", "select 1;", "select *\nfrom emp;"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	expect := "a\\nb|select 1;|select *\nfrom emp;"
+	if result := strings.Join(entriesOf(h), "|"); result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+	// The file keeps the duplicates until it is compacted.
+	if result := strings.Join(entriesOf(New(path)), "|"); result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestMaxSize(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h1 := New(path)
+	h1.MaxSize = 3
+	h2 := New(path)
+	h2.MaxSize = 3
+	for _, entry := range []string{"1", "2", "3", "4", "5", "6"} {
+		if err := h1.Add(entry); err != nil {
+			t.Fatal(err.Error())
+		}
+		if err := h2.Add(entry + "\n" + entry); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if result := strings.Join(entriesOf(h1), "|"); result != "4|5|6" {
+		t.Fatalf("expect %#v, but %#v", "4|5|6", result)
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	// The file is rewritten into the newest 3 entries when it has 6 lines,
+	// and the last entry is appended after that.
+	expect := "5\n5\\n5\n6\n6\\n6\n"
+	if string(data) != expect {
+		t.Fatalf("expect %#v, but %#v", expect, string(data))
+	}
+}
+
+func TestRemoveReplaceAndPin(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := New(path)
+	h.MaxSize = 3
+	for _, entry := range []string{"1", "secret", "3\n3"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if err := h.Remove(1); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := h.Replace(1, "3\n4"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := h.Pin(0, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	if !h.Pinned(0) || h.Pinned(1) {
+		t.Fatal("Pinned returns the wrong value")
+	}
+	for _, entry := range []string{"5", "6", "7"} {
+		if err := h.Add(entry); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	// The pinned entry is not counted in MaxSize.
+	expect := "1|5|6|7"
+	if result := strings.Join(entriesOf(h), "|"); result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+	h2 := New(path)
+	h2.MaxSize = 3
+	if result := strings.Join(entriesOf(h2), "|"); result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+	if !h2.Pinned(0) {
+		t.Fatal("the pinned entry is not loaded as pinned")
+	}
+	data, err := os.ReadFile(path)
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if strings.Contains(string(data), "secret") {
+		t.Fatalf("the removed entry remains in %#v", string(data))
+	}
+	if err := h2.Pin(0, false); err != nil {
+		t.Fatal(err.Error())
+	}
+	if result := strings.Join(entriesOf(New(path)), "|"); result != "5|6|7" {
+		t.Fatalf("expect %#v, but %#v", "5|6|7", result)
+	}
+}
+
+func TestAddEntry(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "history")
+	h := New(path)
+	h.MaxSize = 2
+	at := time.Date(2026, 10, 18, 9, 0, 0, 0, time.UTC)
+	entry := multiline.HistoryEntry{
+		Text:    "select *\nfrom emp;",
+		Time:    at,
+		Dir:     "/tmp",
+		Tags:    []string{"scott@orcl"},
+		Success: true,
+	}
+	if err := h.AddEntry(entry); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := h.Add("select 1;"); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := h.Pin(0, true); err != nil {
+		t.Fatal(err.Error())
+	}
+	if err := h.Replace(0, "select *\nfrom dept;"); err != nil {
+		t.Fatal(err.Error())
+	}
+	// Rewrite the file by adding too many entries.
+	for _, e := range []string{"1", "2", "3"} {
+		if err := h.Add(e); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	entry.Text = "select *\nfrom dept;"
+	for _, h := range []*File{h, New(path)} {
+		h.MaxSize = 2
+		if result := strings.Join(entriesOf(h), "|"); result != "select *\nfrom dept;|2|3" {
+			t.Fatalf("expect %#v, but %#v", "select *\nfrom dept;|2|3", result)
+		}
+		if e := h.EntryAt(0); !reflect.DeepEqual(e, entry) {
+			t.Fatalf("expect %#v, but %#v", entry, e)
+		}
+		if e := h.EntryAt(1); !reflect.DeepEqual(e, multiline.HistoryEntry{Text: "2"}) {
+			t.Fatalf("expect the entry without information, but %#v", e)
+		}
+	}
+}
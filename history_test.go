@@ -0,0 +1,206 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"os"
+	"regexp"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-readline-ny/simplehistory"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+type taggedHistory []HistoryEntry
+
+func (h taggedHistory) Len() int                   { return len(h) }
+func (h taggedHistory) At(i int) string            { return h[i].Text }
+func (h taggedHistory) EntryAt(i int) HistoryEntry { return h[i] }
+
+func (h *taggedHistory) AddEntry(e HistoryEntry) error {
+	*h = append(*h, e)
+	return nil
+}
+
+func TestHistoryFilter(t *testing.T) {
+	history := taggedHistory{
+		{Text: "select 1\nfrom a", Tags: []string{"db1"}},
+		{Text: "select 2", Tags: []string{"db2"}},
+		{Text: "select 3", Tags: []string{"db1"}},
+		{Text: "select 4", Tags: []string{"db2"}},
+	}
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		{[]string{keys.AltP, keys.AltP, keys.CtrlJ}, "select 1\nfrom a"},
+		{[]string{keys.AltP, keys.AltP, keys.AltN, keys.CtrlJ}, "select 3"},
+		{[]string{keys.AltP, keys.AltN, keys.CtrlJ}, ""},
+		{[]string{keys.CtrlR, "s", "\r", keys.CtrlJ}, "select 3"},
+		{[]string{keys.CtrlR, "s", keys.CtrlR, "\r", keys.CtrlJ}, "select 1\nfrom a"},
+	} {
+		ed := Editor{}
+		ed.SetHistory(history)
+		ed.HistoryFilter = func(e HistoryEntry) bool { return e.HasTag("db1") }
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
+
+type editableHistory struct {
+	entries []string
+	pinned  map[string]bool
+}
+
+func (h *editableHistory) Len() int          { return len(h.entries) }
+func (h *editableHistory) At(i int) string   { return h.entries[i] }
+func (h *editableHistory) Pinned(i int) bool { return h.pinned[h.entries[i]] }
+func (h *editableHistory) Remove(i int) error {
+	h.entries = append(h.entries[:i:i], h.entries[i+1:]...)
+	return nil
+}
+func (h *editableHistory) Replace(i int, entry string) error {
+	h.entries[i] = entry
+	return nil
+}
+func (h *editableHistory) Add(entry string) {
+	h.entries = append(h.entries, entry)
+}
+func (h *editableHistory) Pin(i int, pinned bool) error {
+	h.pinned[h.entries[i]] = pinned
+	return nil
+}
+
+func TestEditableHistory(t *testing.T) {
+	for _, p := range []struct {
+		keyin   []string
+		expect  string
+		entries string
+	}{
+		{[]string{keys.AltP, keys.AltP, keys.CtrlX, keys.CtrlD, keys.CtrlJ}, "c", "a|c"},
+		{[]string{"x", keys.AltP, keys.AltP, keys.CtrlX, keys.CtrlD, keys.AltN, keys.CtrlJ}, "x", "a|c"},
+		{[]string{keys.AltP, "!", keys.CtrlX, keys.CtrlS, keys.AltN, keys.AltP, keys.CtrlJ}, "c!", "a|b|c!"},
+		{[]string{keys.AltP, keys.AltP, keys.AltP, keys.CtrlX, keys.CtrlP, keys.CtrlJ}, "a", "a|b|c"},
+		{[]string{keys.CtrlX, keys.CtrlD, keys.CtrlJ}, "", "a|b|c"},
+	} {
+		h := &editableHistory{entries: []string{"a", "b", "c"}, pinned: map[string]bool{}}
+		ed := Editor{}
+		ed.SetHistory(h)
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+		if result := strings.Join(h.entries, "|"); result != p.entries {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.entries, result)
+		}
+	}
+}
+
+func TestPinnedHistory(t *testing.T) {
+	h := &editableHistory{entries: []string{"a", "b", "c"}, pinned: map[string]bool{"a": true}}
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		{[]string{keys.AltP, keys.CtrlJ}, "a"},
+		{[]string{keys.CtrlR, "\r", keys.CtrlJ}, "a"},
+		{[]string{keys.CtrlX, keys.CtrlR, "\r", keys.CtrlJ}, "a"},
+	} {
+		ed := Editor{}
+		ed.SetHistory(h)
+		ed.HistoryFilter = func(HistoryEntry) bool { return false }
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
+
+func TestAddHistory(t *testing.T) {
+	for _, p := range []struct {
+		policy HistoryPolicy
+		expect string
+	}{
+		{HistoryPolicy{}, "a|b|b|a|c  \nd|^x| e"},
+		{HistoryPolicy{IgnoreDups: true}, "a|b|a|c  \nd|^x| e"},
+		{HistoryPolicy{IgnoreDups: true, EraseDups: true}, "b|a|c  \nd|^x| e"},
+		{HistoryPolicy{IgnoreSpace: true, IgnorePattern: regexp.MustCompile(`^\^`)}, "a|b|b|a|c  \nd"},
+		{HistoryPolicy{TrimTrailingSpace: true}, "a|b|b|a|c\nd|^x| e"},
+	} {
+		h := &editableHistory{pinned: map[string]bool{}}
+		ed := Editor{HistoryPolicy: p.policy}
+		ed.SetHistory(h)
+		for _, lines := range [][]string{{"a"}, {"b"}, {"b"}, {"a"}, {"  ", ""}, {"c  ", "d"}, {"^x"}, {" e"}} {
+			if err := ed.AddHistory(lines); err != nil {
+				t.Fatal(err.Error())
+			}
+		}
+		if result := strings.Join(h.entries, "|"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.policy, p.expect, result)
+		}
+	}
+}
+
+func TestEraseDupsWithoutEditableHistory(t *testing.T) {
+	h := simplehistory.New()
+	ed := Editor{HistoryPolicy: HistoryPolicy{EraseDups: true}}
+	ed.SetHistory(h)
+	for _, lines := range [][]string{{"a"}, {"b"}, {"a"}, {"c"}} {
+		if err := ed.AddHistory(lines); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	var entries []string
+	for i := 0; i < h.Len(); i++ {
+		entries = append(entries, h.At(i))
+	}
+	if result := strings.Join(entries, "|"); result != "a|b|c" {
+		t.Fatalf("expect %#v, but %#v", "a|b|c", result)
+	}
+}
+
+func TestAddHistoryEntry(t *testing.T) {
+	h := &taggedHistory{}
+	ed := Editor{HistoryPolicy: HistoryPolicy{IgnoreDups: true, TrimTrailingSpace: true}}
+	ed.SetHistory(h)
+	if err := ed.AddHistory([]string{"select 1; "}); err != nil {
+		t.Fatal(err.Error())
+	}
+	for _, e := range []HistoryEntry{
+		{Text: "select 1;", Tags: []string{"dev"}},
+		{Text: "select 2;  ", Tags: []string{"dev"}, Success: true},
+	} {
+		if err := ed.AddHistoryEntry(e); err != nil {
+			t.Fatal(err.Error())
+		}
+	}
+	if len(*h) != 2 {
+		t.Fatalf("expect 2 entries, but %#v", *h)
+	}
+	dir, _ := os.Getwd()
+	if e := (*h)[0]; e.Text != "select 1;" || e.Time.IsZero() || e.Dir != dir {
+		t.Fatalf("AddHistory adds %#v", e)
+	}
+	if e := (*h)[1]; e.Text != "select 2;" || !e.HasTag("dev") || !e.Success {
+		t.Fatalf("AddHistoryEntry adds %#v", e)
+	}
+}
@@ -0,0 +1,74 @@
+package multiline
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// historySearchQuery returns the string to filter the history with.
+// It is the lines typed when the chain of the history search starts.
+func (m *Editor) historySearchQuery(b *readline.Buffer) string {
+	if m.lastCommand != cmdHistorySearch {
+		m.Sync(b.String())
+		m.historyQuery = strings.Join(m.lines, "\n")
+	}
+	m.thisCommand = cmdHistorySearch
+	return m.historyQuery
+}
+
+// matchesHistory returns true when the i-th entry of the history starts with
+// query (or contains it with HistorySearchSubstring) and is accepted by HistoryFilter.
+func (m *Editor) matchesHistory(i int, query string) bool {
+	if !m.acceptsHistory(i) {
+		return false
+	}
+	entry := m.LineEditor.History.At(i)
+	if m.HistorySearchSubstring {
+		return strings.Contains(entry, query)
+	}
+	return strings.HasPrefix(entry, query)
+}
+
+// CmdHistorySearchBackward fetches the previous entry of the history starting
+// with the lines typed before the chain of this command starts (for Ctrl-Meta-P).
+func (m *Editor) CmdHistorySearchBackward(_ context.Context, b *readline.Buffer) readline.Result {
+	if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
+		return readline.CONTINUE
+	}
+	query := m.historySearchQuery(b)
+	for i := min(m.historyPtr, m.LineEditor.History.Len()) - 1; i >= 0; i-- {
+		if m.matchesHistory(i, query) {
+			m.saveModfiedHistory(b)
+			m.historyPtr = i
+			m.after = m.printCurrentHistoryRecord
+			return readline.ENTER
+		}
+	}
+	return readline.CONTINUE
+}
+
+// CmdHistorySearchForward fetches the next entry of the history starting
+// with the lines typed before the chain of this command starts (for Ctrl-Meta-N).
+// After the newest one, the lines being edited are restored.
+func (m *Editor) CmdHistorySearchForward(_ context.Context, b *readline.Buffer) readline.Result {
+	if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
+		return readline.CONTINUE
+	}
+	query := m.historySearchQuery(b)
+	n := m.LineEditor.History.Len()
+	if m.historyPtr >= n {
+		return readline.CONTINUE
+	}
+	next := m.historyPtr + 1
+	for ; next < n; next++ {
+		if m.matchesHistory(next, query) {
+			break
+		}
+	}
+	m.saveModfiedHistory(b)
+	m.historyPtr = next
+	m.after = m.printCurrentHistoryRecord
+	return readline.ENTER
+}
@@ -0,0 +1,58 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+type testHistory []string
+
+func (h testHistory) Len() int        { return len(h) }
+func (h testHistory) At(i int) string { return h[i] }
+
+func TestHistorySearch(t *testing.T) {
+	history := testHistory{
+		"UPDATE a\nSET x=1",
+		"SELECT 1",
+		"UPDATE b\nSET y=2",
+		"DELETE FROM c",
+	}
+	prev := keys.Escape + keys.CtrlP
+	next := keys.Escape + keys.CtrlN
+	for _, p := range []struct {
+		keyin     []string
+		substring bool
+		upDown    bool
+		expect    string
+	}{
+		{[]string{"U", "P", prev, keys.CtrlJ}, false, false, "UPDATE b\nSET y=2"},
+		{[]string{"U", "P", prev, prev, keys.CtrlJ}, false, false, "UPDATE a\nSET x=1"},
+		{[]string{"U", "P", prev, prev, prev, keys.CtrlJ}, false, false, "UPDATE a\nSET x=1"},
+		{[]string{"U", "P", prev, prev, next, keys.CtrlJ}, false, false, "UPDATE b\nSET y=2"},
+		{[]string{"U", "P", prev, next, keys.CtrlJ}, false, false, "UP"},
+		{[]string{"S", "E", "T", prev, keys.CtrlJ}, false, false, "SET"},
+		{[]string{"S", "E", "T", prev, keys.CtrlJ}, true, false, "UPDATE b\nSET y=2"},
+		{[]string{"U", "P", keys.Up, keys.Up, keys.CtrlJ}, false, true, "UPDATE a\nSET x=1"},
+		{[]string{"U", "P", keys.Up, keys.Up, keys.Down, keys.Down, keys.CtrlJ}, false, true, "UP"},
+		{[]string{"U", "P", keys.Up, keys.CtrlJ}, false, false, "DELETE FROM c"},
+	} {
+		ed := Editor{}
+		ed.SetHistory(history)
+		ed.HistorySearchSubstring = p.substring
+		ed.HistorySearchOnUpDown = p.upDown
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
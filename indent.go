@@ -0,0 +1,191 @@
+package multiline
+
+import (
+	"context"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+const (
+	openBracketChars  = "([{"
+	closeBracketChars = ")]}"
+	quoteChars        = "\"'"
+)
+
+func leadingSpaces(s string) string {
+	return s[:len(s)-len(strings.TrimLeft(s, " \t"))]
+}
+
+// IndentLikePreviousLine is an Indenter which copies the leading white spaces
+// of the line where Enter is typed.
+func IndentLikePreviousLine(lines []string, csrline, _ int) string {
+	if csrline >= len(lines) {
+		return ""
+	}
+	return leadingSpaces(lines[csrline])
+}
+
+type openBracket struct {
+	line   int
+	offset int // the byte offset in the line
+}
+
+// openBrackets returns the brackets not closed before the cursor.
+// The brackets enclosed by quotation marks are ignored.
+func openBrackets(lines []string, csrline, col int) []openBracket {
+	stack := []openBracket{}
+	quote := rune(0)
+	for i := 0; i <= csrline && i < len(lines); i++ {
+		line := lines[i]
+		if i == csrline {
+			line = line[:mojiOffset(line, col)]
+		}
+		for j, c := range line {
+			if quote != 0 {
+				if c == quote {
+					quote = 0
+				}
+			} else if strings.ContainsRune(quoteChars, c) {
+				quote = c
+			} else if strings.ContainsRune(openBracketChars, c) {
+				stack = append(stack, openBracket{line: i, offset: j})
+			} else if strings.ContainsRune(closeBracketChars, c) && len(stack) > 0 {
+				stack = stack[:len(stack)-1]
+			}
+		}
+	}
+	return stack
+}
+
+func startsWithCloseBracket(lines []string, csrline, col int) bool {
+	if csrline >= len(lines) {
+		return false
+	}
+	line := lines[csrline]
+	rest := strings.TrimLeft(line[mojiOffset(line, col):], " \t")
+	return rest != "" && strings.ContainsRune(closeBracketChars, rune(rest[0]))
+}
+
+// IndentByBrackets returns an Indenter which repeats unit as many as
+// the brackets not closed before the cursor.
+func IndentByBrackets(unit string) func([]string, int, int) string {
+	return func(lines []string, csrline, col int) string {
+		depth := len(openBrackets(lines, csrline, col))
+		if depth > 0 && startsWithCloseBracket(lines, csrline, col) {
+			depth--
+		}
+		return strings.Repeat(unit, depth)
+	}
+}
+
+// AlignToOpenBracket is an Indenter which aligns the new line to the next column
+// of the innermost bracket not closed (e.g. for Lisp). Without such brackets,
+// it works as IndentLikePreviousLine.
+func AlignToOpenBracket(lines []string, csrline, col int) string {
+	stack := openBrackets(lines, csrline, col)
+	if len(stack) <= 0 {
+		return IndentLikePreviousLine(lines, csrline, col)
+	}
+	last := stack[len(stack)-1]
+	var buffer strings.Builder
+	for _, c := range lines[last.line][:last.offset+1] {
+		if c == '\t' {
+			buffer.WriteByte('\t')
+		} else {
+			buffer.WriteString(strings.Repeat(" ", runewidth.RuneWidth(c)))
+		}
+	}
+	return buffer.String()
+}
+
+// indentUnit returns the string inserted by CmdIndentLines.
+func (m *Editor) indentUnit() string {
+	if m.ExpandTabs {
+		return strings.Repeat(" ", tabWidth)
+	}
+	return "\t"
+}
+
+// dedentLine removes one indent unit (a tab or the spaces of tabWidth) from s.
+func dedentLine(s string, tabWidth int) string {
+	if strings.HasPrefix(s, "\t") {
+		return s[1:]
+	}
+	n := 0
+	for n < len(s) && n < tabWidth && s[n] == ' ' {
+		n++
+	}
+	if n < len(s) && n < tabWidth && s[n] == '\t' {
+		n++
+	}
+	return s[n:]
+}
+
+// shiftLines replaces the cursor line or the lines of the region
+// with the result of f keeping the region.
+func (m *Editor) shiftLines(b *readline.Buffer, f func(string) string) readline.Result {
+	m.Sync(b.String())
+	first, last := m.lineRange()
+	m.keepRegion = true
+	m.shiftMoved = true
+	m.after = func(line string) bool {
+		m.Sync(line)
+		lines := append([]string{}, m.lines...)
+		for i := first; i <= last; i++ {
+			if strings.TrimSpace(lines[i]) != "" {
+				lines[i] = f(lines[i])
+			}
+		}
+		cursor := m.LineEditor.Cursor + readline.MojiCountInString(lines[m.csrline]) -
+			readline.MojiCountInString(m.lines[m.csrline])
+		m.replaceLines(lines, m.csrline)
+		m.LineEditor.Cursor = max(cursor, 0)
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdIndentLines inserts one indent unit (a tab, or spaces when ExpandTabs is true)
+// at the top of the cursor line or the lines of the region (for Ctrl-X Tab)
+func (m *Editor) CmdIndentLines(_ context.Context, b *readline.Buffer) readline.Result {
+	unit := m.indentUnit()
+	return m.shiftLines(b, func(s string) string { return unit + s })
+}
+
+// CmdDedentLines removes one indent unit from the top of the cursor line
+// or the lines of the region (for Shift-Tab)
+func (m *Editor) CmdDedentLines(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.shiftLines(b, func(s string) string { return dedentLine(s, tabWidth) })
+}
+
+// expandTabs replaces the tabs of s printed from the top of the line
+// with the spaces to the next tab stops.
+func expandTabs(s string) string {
+	var buffer strings.Builder
+	w := 0
+	for _, c := range s {
+		if c == '\t' {
+			n := tabWidth - w%tabWidth
+			buffer.WriteString(strings.Repeat(" ", n))
+			w += n
+		} else {
+			buffer.WriteRune(c)
+			w += runewidth.RuneWidth(c)
+		}
+	}
+	return buffer.String()
+}
+
+// CmdInsertTab inserts a tab, or the spaces to the next tab stop
+// when ExpandTabs is true (for Tab)
+func (m *Editor) CmdInsertTab(_ context.Context, b *readline.Buffer) readline.Result {
+	if !m.ExpandTabs {
+		b.InsertAndRepaint("\t")
+		return readline.CONTINUE
+	}
+	w := m.displayColumn(b.String(), b.Cursor)
+	b.InsertAndRepaint(strings.Repeat(" ", tabWidth-w%tabWidth))
+	return readline.CONTINUE
+}
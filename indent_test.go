@@ -0,0 +1,102 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestIndenters(t *testing.T) {
+	lines := []string{"(defun f (x)", "  (if (< x 0)"}
+	col := len(lines[1])
+	if got := IndentLikePreviousLine(lines, 1, col); got != "  " {
+		t.Fatalf("IndentLikePreviousLine: %#v", got)
+	}
+	if got := IndentByBrackets("  ")(lines, 1, col); got != "    " {
+		t.Fatalf("IndentByBrackets: %#v", got)
+	}
+	if got := AlignToOpenBracket(lines, 1, col); got != "   " {
+		t.Fatalf("AlignToOpenBracket: %#v", got)
+	}
+	quoted := []string{`SELECT ")" FROM (`}
+	if got := IndentByBrackets("\t")(quoted, 0, len(quoted[0])); got != "\t" {
+		t.Fatalf("IndentByBrackets with quotation: %#v", got)
+	}
+}
+
+func TestNewLineWithIndenter(t *testing.T) {
+	keyin := strings.Split("SELECT *\rFROM (\rDUAL)\rWHERE", "")
+	keyin = append(keyin, "\n")
+
+	var ed Editor
+	ed.Indenter = IndentByBrackets("  ")
+	result := readWithKeys(t, &ed, keyin)
+	expect := "SELECT *\nFROM (\n  DUAL)\nWHERE"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestNewLineWithoutIndenter(t *testing.T) {
+	for _, p := range []struct {
+		indenter func([]string, int, int) string
+		expect   string
+	}{
+		{nil, "\t a\nb\nc"},
+		{IndentLikePreviousLine, "\t a\n\t b\n\t c"},
+	} {
+		keyin := strings.Split("\t a\rb\rc", "")
+		keyin = append(keyin, "\n")
+
+		ed := Editor{Indenter: p.indenter}
+		result := readWithKeys(t, &ed, keyin)
+		if result != p.expect {
+			t.Fatalf("expect %#v, but %#v", p.expect, result)
+		}
+	}
+}
+
+func TestIndentAndDedentLines(t *testing.T) {
+	keyin := strings.Split("(a\rb)", "")
+	// Indent both lines, and dedent the second line
+	keyin = append(keyin, keys.Up, keys.CtrlA, keyShiftDown, keyShiftRight, keys.CtrlX, "\t", keys.CtrlX, "\t")
+	keyin = append(keyin, keys.CtrlG, keys.ShiftTab, keys.CtrlJ)
+
+	ed := Editor{ExpandTabs: true}
+	result := readWithKeys(t, &ed, keyin)
+	expect := "        (a\n    b)"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestExpandTabs(t *testing.T) {
+	for _, p := range []struct {
+		expandTabs bool
+		expect     string
+	}{
+		{false, "\tab\tc\n\td"},
+		{true, "    ab  c\n    d"},
+	} {
+		keyin := []string{"\t", "a", "b", "\t", "c", keys.CtrlM, "d", keys.CtrlJ}
+		ed := Editor{ExpandTabs: p.expandTabs, Indenter: IndentLikePreviousLine}
+		result := readWithKeys(t, &ed, keyin)
+		if result != p.expect {
+			t.Fatalf("expect %#v, but %#v", p.expect, result)
+		}
+	}
+}
+
+func TestDedentLine(t *testing.T) {
+	for _, p := range [][2]string{
+		{"\t\tx", "\tx"},
+		{"      x", "  x"},
+		{"  \tx", "x"},
+		{"x", "x"},
+	} {
+		if result := dedentLine(p[0], 4); result != p[1] {
+			t.Fatalf("dedentLine(%#v): expect %#v, but %#v", p[0], p[1], result)
+		}
+	}
+}
@@ -4,17 +4,15 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"regexp"
 	"strings"
 	"unicode"
 	"unicode/utf8"
 
 	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
 )
 
-func caseInsensitiveStringContains(s, t string) bool {
-	return strings.Contains(strings.ToUpper(s), strings.ToUpper(t))
-}
-
 const (
 	ansiCursorOff = "\x1B[?25l"
 
@@ -26,49 +24,242 @@ const (
 // NewLineMarkForIncrementalSearch is the string used instead of "\n". This variable is not guaranteed to remain valid in the future.
 var NewLineMarkForIncrementalSearch = "\u21B2 "
 
-func (m *Editor) cmdISearchBackward(ctx context.Context, this *readline.Buffer) readline.Result {
-	var searchBuf strings.Builder
-	foundStr := ""
-	searchStr := ""
-	lastFoundPos := this.History.Len() - 1
+const defaultISearchMatchColor = "\x1B[7m"
+
+func (m *Editor) iSearchMatchColor() string {
+	if m.ISearchMatchColor == "" {
+		return defaultISearchMatchColor
+	}
+	return m.ISearchMatchColor
+}
+
+// isearch is the state of the incremental search.
+type isearch struct {
+	m             *Editor
+	history       readline.IHistory
+	searchStr     string
+	forward       bool
+	caseSensitive bool
+	useRegexp     bool
+	pattern       *regexp.Regexp // nil when searchStr is an invalid regular expression
+
+	found      int // the index of the entry found. -1 means not found
+	foundStr   string
+	matchStart int // the byte offset of the matched string in foundStr
+	matchEnd   int
+}
+
+func (s *isearch) compile() {
+	pattern := s.searchStr
+	if !s.useRegexp {
+		pattern = regexp.QuoteMeta(pattern)
+	}
+	if !s.caseSensitive {
+		pattern = "(?i)" + pattern
+	}
+	var err error
+	if s.pattern, err = regexp.Compile(pattern); err != nil {
+		s.pattern = nil
+	}
+}
+
+// find searches the entry matching from the i-th entry toward the direction.
+// When wrap is true, it continues from the other end of the history.
+// The entries equal to skip are ignored.
+func (s *isearch) find(i int, wrap bool, skip string) bool {
+	n := s.history.Len()
+	if s.pattern == nil || n <= 0 {
+		return false
+	}
+	step := -1
+	if s.forward {
+		step = 1
+	}
+	for count := 0; count < n; count++ {
+		if i < 0 || i >= n {
+			if !wrap {
+				return false
+			}
+			i = (i + n) % n
+		}
+		if s.m.acceptsHistory(i) {
+			entry := s.history.At(i)
+			if loc := s.pattern.FindStringIndex(entry); loc != nil && entry != skip {
+				s.found = i
+				s.foundStr = entry
+				s.matchStart, s.matchEnd = loc[0], loc[1]
+				return true
+			}
+		}
+		i += step
+	}
+	return false
+}
+
+// update searches again from the newest entry (or the oldest one for
+// the forward search) after the condition is changed.
+func (s *isearch) update() {
+	s.compile()
+	start := s.history.Len() - 1
+	if s.forward {
+		start = 0
+	}
+	if !s.find(start, false, "") {
+		s.found = -1
+		s.foundStr = ""
+		s.matchStart, s.matchEnd = 0, 0
+	}
+}
+
+// next searches the next entry toward the direction.
+func (s *isearch) next(forward bool) {
+	s.forward = forward
+	if s.found < 0 {
+		s.update()
+		return
+	}
+	step := -1
+	if forward {
+		step = 1
+	}
+	// Only the backward search goes around as before.
+	s.find(s.found+step, !forward, s.foundStr)
+}
+
+func (s *isearch) prompt() string {
+	var buffer strings.Builder
+	buffer.WriteByte('(')
+	if s.forward {
+		buffer.WriteString("forward-")
+	}
+	buffer.WriteString("i-search")
+	if s.caseSensitive {
+		buffer.WriteString(" case")
+	}
+	if s.useRegexp {
+		buffer.WriteString(" regexp")
+	}
+	if s.pattern == nil {
+		buffer.WriteString(" invalid")
+	}
+	fmt.Fprintf(&buffer, ")[%s]:", s.searchStr)
+	return buffer.String()
+}
+
+// printRow prints text within width highlighting text[start:end]
+// and returns the width printed.
+func (m *Editor) printRow(out io.Writer, text string, width readline.WidthT, start, end int) readline.WidthT {
+	drawWidth := readline.WidthT(0)
+	offset := 0
+	highlighted := false
+	for _, ch := range readline.StringToMoji(text) {
+		w1 := ch.Width()
+		if drawWidth+w1 >= width {
+			break
+		}
+		if on := start <= offset && offset < end; on != highlighted {
+			if on {
+				io.WriteString(out, m.iSearchMatchColor())
+			} else {
+				io.WriteString(out, resetSGR)
+			}
+			highlighted = on
+		}
+		var buffer strings.Builder
+		ch.WriteTo(&buffer)
+		offset += buffer.Len()
+		ch.PrintTo(out)
+		drawWidth += w1
+	}
+	if highlighted {
+		io.WriteString(out, resetSGR)
+	}
+	return drawWidth
+}
+
+// draw prints the search string and the entry found. The entry is previewed
+// in at most maxRows rows below the search string, or in the row of it with
+// NewLineMarkForIncrementalSearch when maxRows is zero.
+// The cursor is left in the row of the search string.
+func (s *isearch) draw(out io.Writer, width readline.WidthT, maxRows int) {
+	prompt := s.prompt()
+	io.WriteString(out, "\r")
+	if maxRows <= 0 {
+		mark := NewLineMarkForIncrementalSearch
+		// The offsets move as many as the marks replacing "\n" before them.
+		start := s.matchStart + strings.Count(s.foundStr[:s.matchStart], "\n")*(len(mark)-1)
+		end := s.matchEnd + strings.Count(s.foundStr[:s.matchEnd], "\n")*(len(mark)-1)
+		w := s.m.printRow(out, prompt, width, 0, 0)
+		s.m.printRow(out, strings.ReplaceAll(s.foundStr, "\n", mark), width-w, start, end)
+		io.WriteString(out, "\x1B[K")
+		return
+	}
+	s.m.printRow(out, prompt, width, 0, 0)
+	io.WriteString(out, "\x1B[K")
+
+	lines := strings.Split(s.foundStr, "\n")
+	// the first line to preview so that the matched line is shown
+	first := 0
+	if matchLine := strings.Count(s.foundStr[:s.matchStart], "\n"); matchLine >= maxRows {
+		first = matchLine - maxRows + 1
+	}
+	offset := 0
+	for _, line := range lines[:first] {
+		offset += len(line) + 1
+	}
+	rows := 0
+	for _, line := range lines[first:] {
+		if rows >= maxRows {
+			break
+		}
+		io.WriteString(out, "\n")
+		s.m.printRow(out, line, width, s.matchStart-offset, s.matchEnd-offset)
+		io.WriteString(out, "\x1B[K")
+		offset += len(line) + 1
+		rows++
+	}
+	io.WriteString(out, "\x1B[J")
+	if rows > 0 {
+		fmt.Fprintf(out, "\x1B[%dF", rows)
+	}
+}
+
+// previewRows returns the count of the rows which the preview can use
+// below the search string without scrolling the lines out of the screen.
+// When the terminal tells where the cursor is, the rows above the lines
+// are not used either. It must be called on the cursor line.
+func (m *Editor) previewRows() int {
+	rows := m.viewHeight + m.StatusLineHeight - m.visibleRows() - 1
+	if tty, ok := m.LineEditor.Tty.(*resizeTty); ok {
+		if row, ok := tty.cursorRow(m.LineEditor.Out); ok {
+			// the rows above the headline
+			rows -= max(row-1-m.cursorRow(), 0)
+		}
+	}
+	return max(rows, 0)
+}
 
+func (m *Editor) cmdISearch(this *readline.Buffer, forward bool) readline.Result {
+	s := &isearch{
+		m:       m,
+		history: this.History,
+		forward: forward,
+	}
+	s.update()
+
+	maxRows := m.previewRows()
 	moveOriginalLine := m.GotoEndLine()
 
 	defer func() {
-		io.WriteString(this.Out, "\x1B[2K")
+		io.WriteString(this.Out, "\r\x1B[J")
 		moveOriginalLine()
 		this.Out.Flush()
 		this.RepaintLastLine()
 	}()
 
-	update := func() {
-		for i := this.History.Len() - 1; ; i-- {
-			if i < 0 {
-				foundStr = ""
-				break
-			}
-			line := this.History.At(i)
-			if caseInsensitiveStringContains(line, searchStr) {
-				foundStr = line
-				lastFoundPos = i
-				break
-			}
-		}
-	}
 	for {
-		drawStr := fmt.Sprintf("(i-search)[%s]:%s", searchStr,
-			strings.ReplaceAll(foundStr, "\n", NewLineMarkForIncrementalSearch))
-		drawWidth := readline.WidthT(0)
-		this.Out.Write([]byte{'\r'})
-		for _, ch := range readline.StringToMoji(drawStr) {
-			w1 := ch.Width()
-			if drawWidth+w1 >= this.ViewWidth() {
-				break
-			}
-			ch.PrintTo(this.Out)
-			drawWidth += w1
-		}
-		io.WriteString(this.Out, "\x1B[K"+ansiCursorOn)
+		s.draw(this.Out, this.ViewWidth(), maxRows)
+		io.WriteString(this.Out, ansiCursorOn)
 		key, err := this.GetKey()
 		if err != nil {
 			println(err.Error())
@@ -78,70 +269,61 @@ func (m *Editor) cmdISearchBackward(ctx context.Context, this *readline.Buffer)
 
 		switch key {
 		case "\b", "\x7F":
-			searchBuf.Reset()
 			// chop last char
-			var lastchar rune
-			for i, c := range searchStr {
-				if i > 0 {
-					searchBuf.WriteRune(lastchar)
-				}
-				lastchar = c
-			}
-			searchStr = searchBuf.String()
-			update()
+			_, size := utf8.DecodeLastRuneInString(s.searchStr)
+			s.searchStr = s.searchStr[:len(s.searchStr)-size]
+			s.update()
 		case "\r":
+			if s.found < 0 {
+				return readline.CONTINUE
+			}
+			foundStr := s.foundStr
+			before := foundStr[:s.matchStart]
 			m.after = func(string) bool {
 				m.clearLines()
 				m.lines = strings.Split(foundStr, "\n")
-				m.csrline = len(m.lines) - 1
+				m.csrline = strings.Count(before, "\n")
 				m.adjustHeadline()
 				lfCount := m.PrintFromLine(m.headline)
-				lfCount -= (m.csrline - m.headline)
+				lfCount -= m.cursorRow()
 				m.up(lfCount)
-				m.LineEditor.Cursor = 9999
+				// the cursor is put on the top of the matched string
+				m.LineEditor.Cursor = readline.MojiCountInString(before[strings.LastIndexByte(before, '\n')+1:])
 				return true
 			}
 			return readline.ENTER
 		case "\x03", "\x07", "\x1B":
 			return readline.CONTINUE
-		case "\x12":
-			for i := lastFoundPos - 1; ; i-- {
-				if i < 0 {
-					i = this.History.Len() - 1
-				}
-				if i == lastFoundPos {
-					break
-				}
-				line := this.History.At(i)
-				if caseInsensitiveStringContains(line, searchStr) && foundStr != line {
-					foundStr = line
-					lastFoundPos = i
-					break
-				}
-			}
-		case "\x13":
-			for i := lastFoundPos + 1; ; i++ {
-				if i >= this.History.Len() {
-					break
-				}
-				if i == lastFoundPos {
-					break
-				}
-				line := this.History.At(i)
-				if caseInsensitiveStringContains(line, searchStr) && foundStr != line {
-					foundStr = line
-					lastFoundPos = i
-					break
-				}
-			}
+		case keys.CtrlR:
+			s.next(false)
+		case keys.CtrlS:
+			s.next(true)
+		case keys.AltC:
+			s.caseSensitive = !s.caseSensitive
+			s.update()
+		case keys.AltR:
+			s.useRegexp = !s.useRegexp
+			s.update()
 		default:
 			charcode, _ := utf8.DecodeRuneInString(key)
 			if unicode.IsControl(charcode) {
 				break
 			}
-			searchBuf.WriteRune(charcode)
-			searchStr = searchBuf.String()
-			update()
+			s.searchStr += string(charcode)
+			s.update()
 		}
 	}
 }
+
+// CmdISearchBackward searches the history from the newest entry
+// incrementally (for Ctrl-R). In the search, Ctrl-R and Ctrl-S find the older
+// and the newer entry, and Meta-C and Meta-R toggle case sensitivity and
+// regular expressions.
+func (m *Editor) CmdISearchBackward(_ context.Context, this *readline.Buffer) readline.Result {
+	return m.cmdISearch(this, false)
+}
+
+// CmdISearchForward searches the history from the oldest entry incrementally (for Ctrl-S)
+func (m *Editor) CmdISearchForward(_ context.Context, this *readline.Buffer) readline.Result {
+	return m.cmdISearch(this, true)
+}
@@ -0,0 +1,96 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-readline-ny/simplehistory"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestISearch(t *testing.T) {
+	history := simplehistory.New()
+	history.Add("select *\nfrom Emp\nwhere x")
+	history.Add("select 1")
+	history.Add("foo\nbar emp\nbaz")
+
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		// the cursor is put on the match
+		{[]string{keys.CtrlR, "e", "m", "p", "\r", "X", keys.CtrlJ}, "foo\nbar Xemp\nbaz"},
+		{[]string{keys.CtrlR, "e", "m", "p", keys.CtrlR, "\r", "X", keys.CtrlJ}, "select *\nfrom XEmp\nwhere x"},
+		// forward search starts from the oldest entry
+		{[]string{keys.CtrlS, "s", "e", "l", keys.CtrlS, "\r", "X", keys.CtrlJ}, "Xselect 1"},
+		{[]string{keys.CtrlR, "s", "e", "l", keys.CtrlR, keys.CtrlS, "\r", "X", keys.CtrlJ}, "Xselect 1"},
+		// case sensitivity
+		{[]string{keys.CtrlR, "E", "m", "p", keys.AltC, "\r", "X", keys.CtrlJ}, "select *\nfrom XEmp\nwhere x"},
+		{[]string{"a", keys.CtrlR, "E", "M", "P", keys.AltC, "\r", keys.CtrlJ}, "a"},
+		// regular expression
+		{[]string{keys.CtrlR, keys.AltR, "x", "$", "\r", "X", keys.CtrlJ}, "select *\nfrom Emp\nwhere Xx"},
+		{[]string{keys.CtrlR, "x", "$", "\r", keys.CtrlJ}, ""},
+	} {
+		ed := Editor{}
+		ed.SetHistory(history)
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
+
+// reportingWriter answers `ESC[6n` with the row of the cursor as a terminal
+// and keeps the output.
+type reportingWriter struct {
+	tty *auto.Pilot
+	row string
+	out strings.Builder
+}
+
+func (w *reportingWriter) Write(p []byte) (int, error) {
+	if w.row != "" && strings.Contains(string(p), "\x1B[6n") {
+		w.tty.Text = append([]string{"\x1B[" + w.row + ";1R"}, w.tty.Text...)
+	}
+	return w.out.Write(p)
+}
+
+func TestPreviewRows(t *testing.T) {
+	for _, p := range []struct {
+		row    string
+		expect int
+	}{
+		{"", 24 - 2 - 1},        // the terminal does not answer
+		{"1", 24 - 2 - 1},       // the lines start at the top of the screen
+		{"21", 24 - 2 - 1 - 19}, // 19 rows are above the lines
+	} {
+		tty := &auto.Pilot{Text: []string{"a", keys.CtrlM, "b", keys.CtrlT, "c", keys.CtrlJ}}
+		ed := Editor{}
+		ed.LineEditor.Tty = tty
+		ed.SetWriter(&reportingWriter{tty: tty, row: p.row})
+		rows := -1
+		ed.BindKey(keys.CtrlT, readline.AnonymousCommand(func(context.Context, *readline.Buffer) readline.Result {
+			rows = ed.previewRows()
+			return readline.CONTINUE
+		}))
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != "a\nbc" {
+			t.Fatalf("%#v: expect %#v, but %#v", p.row, "a\nbc", result)
+		}
+		if rows != p.expect {
+			t.Fatalf("%#v: expect %d rows, but %d", p.row, p.expect, rows)
+		}
+	}
+}
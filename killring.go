@@ -0,0 +1,240 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// commandKind tells what the last command did,
+// to join successive kills, to allow yank-pop only after yank
+// to keep the goal column during vertical movement
+// and to keep the string to search the history with.
+type commandKind int
+
+const (
+	cmdOther commandKind = iota
+	cmdKill
+	cmdYank
+	cmdVertical
+	cmdHistorySearch
+)
+
+const defaultKillRingMax = 60
+
+// kill saves the removed text into the kill ring (and the clipboard unless KillRingNoClipboard).
+// When the previous command also killed, the text is joined to the newest entry.
+func (m *Editor) kill(text string, backward bool) {
+	m.thisCommand = cmdKill
+	if text == "" {
+		return
+	}
+	if m.lastCommand == cmdKill && len(m.killRing) > 0 {
+		last := len(m.killRing) - 1
+		if backward {
+			m.killRing[last] = text + m.killRing[last]
+		} else {
+			m.killRing[last] += text
+		}
+	} else {
+		m.pushKillRing(text)
+	}
+	if !m.KillRingNoClipboard {
+		m.LineEditor.Clipboard.Write(m.killRing[len(m.killRing)-1])
+	}
+}
+
+func (m *Editor) pushKillRing(text string) {
+	max := m.KillRingMax
+	if max <= 0 {
+		max = defaultKillRingMax
+	}
+	m.killRing = append(m.killRing, text)
+	if len(m.killRing) > max {
+		m.killRing = m.killRing[len(m.killRing)-max:]
+	}
+}
+
+func trimYankText(text string) string {
+	text = strings.TrimRight(text, "\r\n\000")
+	return strings.ReplaceAll(text, "\r\n", "\n")
+}
+
+// currentKill returns the newest entry of the kill ring.
+// Unless KillRingNoClipboard, when the clipboard was changed by the other
+// application, its text is pushed into the kill ring as the newest entry.
+func (m *Editor) currentKill() (string, bool) {
+	if !m.KillRingNoClipboard {
+		if text, err := m.LineEditor.Clipboard.Read(); err == nil {
+			text = trimYankText(text)
+			if text != "" && (len(m.killRing) <= 0 ||
+				trimYankText(m.killRing[len(m.killRing)-1]) != text) {
+				m.pushKillRing(text)
+			}
+		}
+	}
+	if len(m.killRing) <= 0 {
+		return "", false
+	}
+	m.yankIndex = len(m.killRing) - 1
+	return m.killRing[m.yankIndex], true
+}
+
+// insertText returns the new lines into which text is inserted at pos
+// and the position where the inserted text ends.
+func insertText(lines []string, pos position, text string) ([]string, position) {
+	newlines := strings.Split(text, "\n")
+	s := lines[pos.line]
+	offset := mojiOffset(s, pos.col)
+	last := len(newlines) - 1
+	newlines[0] = s[:offset] + newlines[0]
+	end := position{line: pos.line + last, col: readline.MojiCountInString(newlines[last])}
+	newlines[last] += s[offset:]
+
+	result := make([]string, 0, len(lines)+last)
+	result = append(result, lines[:pos.line]...)
+	result = append(result, newlines...)
+	result = append(result, lines[pos.line+1:]...)
+	return result, end
+}
+
+// removedText returns the text which exists in before but not in after.
+func removedText(before, after string) string {
+	o := mojiStrings(before)
+	n := mojiStrings(after)
+	prefix, suffix := commonEnds(o, n)
+	return strings.Join(o[prefix:len(o)-suffix], "")
+}
+
+// noClipboard replaces LineEditor.Clipboard while the commands of
+// go-readline-ny remove text with KillRingNoClipboard,
+// because they write the removed text into the clipboard by themselves.
+type noClipboard struct{}
+
+func (noClipboard) Read() (string, error) { return "", nil }
+func (noClipboard) Write(string) error    { return nil }
+
+// callKillCommand calls the command of go-readline-ny which removes text
+// and saves the removed text into the kill ring.
+func (m *Editor) callKillCommand(ctx context.Context, b *readline.Buffer, f readline.Command, backward bool) readline.Result {
+	if m.KillRingNoClipboard {
+		clipboard := m.LineEditor.Clipboard
+		m.LineEditor.Clipboard = noClipboard{}
+		defer func() { m.LineEditor.Clipboard = clipboard }()
+	}
+	before := b.String()
+	rc := f.Call(ctx, b)
+	m.kill(removedText(before, b.String()), backward)
+	return rc
+}
+
+// CmdKillLine removes the text from the cursor to the end of the line (for Ctrl-K).
+// At the end of the line, it joins the next line.
+func (m *Editor) CmdKillLine(ctx context.Context, b *readline.Buffer) readline.Result {
+	if b.Cursor < len(b.Buffer) {
+		return m.callKillCommand(ctx, b, readline.CmdKillLine, false)
+	}
+	if m.csrline+1 >= len(m.lines) {
+		return readline.CONTINUE
+	}
+	m.kill("\n", false)
+	return m.CmdDeleteChar(ctx, b)
+}
+
+// CmdUnixLineDiscard removes the text from the top of the line to the cursor (for Ctrl-U)
+func (m *Editor) CmdUnixLineDiscard(ctx context.Context, b *readline.Buffer) readline.Result {
+	return m.callKillCommand(ctx, b, readline.CmdUnixLineDiscard, true)
+}
+
+// killBetween removes the text from start to end which may be on the different lines
+// and saves it into the kill ring.
+func (m *Editor) killBetween(start, end position, backward bool) readline.Result {
+	m.kill(regionText(m.lines, start, end), backward)
+	m.after = func(line string) bool {
+		m.Sync(line)
+		m.replaceLines(deleteRegion(m.lines, start, end), start.line)
+		m.LineEditor.Cursor = start.col
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdKillWord removes the word after the cursor (for Meta-D).
+// When only white spaces are after the cursor, it joins the next lines.
+func (m *Editor) CmdKillWord(ctx context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	start := m.cursorPosition()
+	end := forwardWordEnd(m.lines, start)
+	if end.line == start.line {
+		return m.callKillCommand(ctx, b, readline.CmdKillWord, false)
+	}
+	return m.killBetween(start, end, false)
+}
+
+// CmdBackwardKillWord removes the word before the cursor (for Meta-Backspace).
+// When only white spaces are before the cursor, it joins the previous lines.
+func (m *Editor) CmdBackwardKillWord(ctx context.Context, b *readline.Buffer) readline.Result {
+	return m.backwardKillWord(ctx, b, readline.CmdBackwardKillWord)
+}
+
+// CmdUnixWordRubout removes the word before the cursor (for Ctrl-W without the region).
+// When only white spaces are before the cursor, it joins the previous lines.
+func (m *Editor) CmdUnixWordRubout(ctx context.Context, b *readline.Buffer) readline.Result {
+	return m.backwardKillWord(ctx, b, readline.CmdUnixWordRubout)
+}
+
+func (m *Editor) backwardKillWord(ctx context.Context, b *readline.Buffer, f readline.Command) readline.Result {
+	m.Sync(b.String())
+	end := m.cursorPosition()
+	start := backwardWordStart(m.lines, end)
+	if start.line == end.line {
+		return m.callKillCommand(ctx, b, f, true)
+	}
+	return m.killBetween(start, end, true)
+}
+
+// CmdKillWholeLine removes the cursor line including its newline (for Ctrl-X Ctrl-K).
+func (m *Editor) CmdKillWholeLine(_ context.Context, b *readline.Buffer) readline.Result {
+	m.kill(b.String()+"\n", false)
+	m.after = func(string) bool {
+		if m.csrline >= len(m.lines) {
+			m.lines = append(m.lines, "")
+		}
+		lines := make([]string, 0, len(m.lines))
+		lines = append(lines, m.lines[:m.csrline]...)
+		lines = append(lines, m.lines[m.csrline+1:]...)
+		if len(lines) <= 0 {
+			lines = append(lines, "")
+		}
+		m.replaceLines(lines, min(m.csrline, len(lines)-1))
+		m.LineEditor.Cursor = 0
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdYankPop replaces the text inserted by the last yank with the previous entry of the kill ring (for Meta-Y)
+func (m *Editor) CmdYankPop(_ context.Context, b *readline.Buffer) readline.Result {
+	if m.lastCommand != cmdYank || len(m.killRing) <= 0 {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.yankIndex--
+	if m.yankIndex < 0 {
+		m.yankIndex = len(m.killRing) - 1
+	}
+	text := m.killRing[m.yankIndex]
+	start, end := m.yankStart, m.yankEnd
+	m.thisCommand = cmdYank
+	m.after = func(line string) bool {
+		m.Sync(line)
+		lines, newEnd := insertText(deleteRegion(m.lines, start, end), start, text)
+		m.replaceLines(lines, newEnd.line)
+		m.LineEditor.Cursor = newEnd.col
+		m.yankEnd = newEnd
+		return true
+	}
+	return readline.ENTER
+}
@@ -0,0 +1,108 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestYankPop(t *testing.T) {
+	keyin := strings.Split("one", "")
+	keyin = append(keyin, keys.CtrlA, keys.CtrlK)
+	keyin = append(keyin, strings.Split("two", "")...)
+	keyin = append(keyin, keys.CtrlA, keys.CtrlK)
+	keyin = append(keyin, keys.CtrlY, keys.AltY, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "one"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestYankPopMultiLine(t *testing.T) {
+	// Kill `b\nc` as a region, and kill `d` with Ctrl-K
+	keyin := strings.Split("ab\rcd", "")
+	keyin = append(keyin, keys.CtrlB, keys.Up, keyShiftDown, keys.CtrlW)
+	keyin = append(keyin, keys.CtrlE, keys.CtrlB, keys.CtrlK)
+	// Yank `d`, and replace it with `b\nc`
+	keyin = append(keyin, keys.CtrlY, keys.AltY, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "ab\nc"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestKillLineJoinsLines(t *testing.T) {
+	keyin := strings.Split("ab\rcd", "")
+	keyin = append(keyin, keys.Up, keys.CtrlA, keys.CtrlK, keys.CtrlK, keys.CtrlE, keys.CtrlY, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "cdab\n"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+type testClipboard struct {
+	text string
+}
+
+func (c *testClipboard) Read() (string, error) { return c.text, nil }
+func (c *testClipboard) Write(s string) error  { c.text = s; return nil }
+
+func TestKillRingClipboard(t *testing.T) {
+	for _, p := range []struct {
+		private   bool
+		keyin     []string
+		expect    string
+		clipboard string
+	}{
+		{true, []string{"a", "b", keys.CtrlA, keys.CtrlK, keys.CtrlY, keys.CtrlY, keys.CtrlJ}, "abab", "copied"},
+		{false, []string{"a", "b", keys.CtrlA, keys.CtrlK, keys.CtrlY, keys.CtrlY, keys.CtrlJ}, "abab", "ab"},
+		{true, []string{"a", keys.CtrlY, keys.CtrlJ}, "a", "copied"},
+		{false, []string{"a", keys.CtrlY, keys.CtrlJ}, "acopied", "copied"},
+		{false, []string{"a", "b", keyCtrlSpace, keys.CtrlA, keys.AltW, keys.CtrlJ}, "ab", "ab"},
+	} {
+		clipboard := &testClipboard{text: "copied"}
+		ed := Editor{KillRingNoClipboard: p.private}
+		ed.LineEditor.Clipboard = clipboard
+		result := readWithKeys(t, &ed, p.keyin)
+		if result != p.expect {
+			t.Fatalf("%v %#v: expect %#v, but %#v", p.private, p.keyin, p.expect, result)
+		}
+		if clipboard.text != p.clipboard {
+			t.Fatalf("%v %#v: expect clipboard %#v, but %#v", p.private, p.keyin, p.clipboard, clipboard.text)
+		}
+	}
+}
+
+func TestKillWholeLine(t *testing.T) {
+	keyin := strings.Split("ab\rcd\ref", "")
+	keyin = append(keyin, keys.Up, keys.CtrlX, keys.CtrlK, keys.Down, keys.CtrlE, keys.CtrlM, keys.CtrlY, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "ab\nef\ncd\n"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestYankMetaV(t *testing.T) {
+	keyin := strings.Split("ab\rcd", "")
+	keyin = append(keyin, keys.CtrlB, keys.Up, keyShiftDown, keys.CtrlW, keys.AltV, keys.AltV, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "ab\ncb\ncd"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
@@ -0,0 +1,116 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+const (
+	keyAltUp   = "\x1B[1;3A"
+	keyAltDown = "\x1B[1;3B"
+)
+
+// lineRange returns the first and the last line of the selected region,
+// or the cursor line when the region is not active. The last line of the region
+// is not included when the region ends at its beginning.
+func (m *Editor) lineRange() (first, last int) {
+	start, end, ok := m.region()
+	if !ok {
+		return m.csrline, m.csrline
+	}
+	if end.col == 0 && end.line > start.line {
+		end.line--
+	}
+	return start.line, end.line
+}
+
+// moveLines moves the lines of lineRange by delta lines keeping the region.
+func (m *Editor) moveLines(b *readline.Buffer, delta int) readline.Result {
+	m.Sync(b.String())
+	first, last := m.lineRange()
+	bottom := max(last, m.csrline)
+	if m.markActive {
+		bottom = max(bottom, m.mark.line)
+	}
+	if first+delta < 0 || bottom+delta >= len(m.lines) {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.keepRegion = true
+	m.shiftMoved = true
+	m.after = func(line string) bool {
+		m.Sync(line)
+		block := append([]string{}, m.lines[first:last+1]...)
+		lines := make([]string, 0, len(m.lines))
+		lines = append(lines, m.lines[:first]...)
+		lines = append(lines, m.lines[last+1:]...)
+		lines = insertSliceAt(lines, first+delta, block)
+		m.mark.line += delta
+		m.replaceLines(lines, m.csrline+delta)
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdMoveLineUp swaps the cursor line or the lines of the region
+// with the previous line (for Meta-Up)
+func (m *Editor) CmdMoveLineUp(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.moveLines(b, -1)
+}
+
+// CmdMoveLineDown swaps the cursor line or the lines of the region
+// with the next line (for Meta-Down)
+func (m *Editor) CmdMoveLineDown(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.moveLines(b, +1)
+}
+
+// CmdDuplicateLine inserts the copy of the cursor line or the lines of the region
+// after them and moves the cursor into the copy (for Ctrl-X d)
+func (m *Editor) CmdDuplicateLine(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	first, last := m.lineRange()
+	m.markActive = false
+	m.after = func(line string) bool {
+		m.Sync(line)
+		block := append([]string{}, m.lines[first:last+1]...)
+		lines := insertSliceAt(append([]string{}, m.lines...), last+1, block)
+		m.replaceLines(lines, m.csrline+len(block))
+		return true
+	}
+	return readline.ENTER
+}
+
+// joinLines joins two lines with one space removing
+// the white spaces around the junction.
+func joinLines(upper, lower string) string {
+	upper = strings.TrimRight(upper, " \t")
+	lower = strings.TrimLeft(lower, " \t")
+	if upper == "" || lower == "" {
+		return upper + lower
+	}
+	return upper + " " + lower
+}
+
+// CmdJoinLine joins the next line to the cursor line with one space (for Meta-^)
+func (m *Editor) CmdJoinLine(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	if m.csrline+1 >= len(m.lines) {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.after = func(line string) bool {
+		m.Sync(line)
+		upper := strings.TrimRight(m.lines[m.csrline], " \t")
+		joined := joinLines(upper, m.lines[m.csrline+1])
+		lines := append([]string{}, m.lines...)
+		lines[m.csrline] = joined
+		lines = deleteSliceAt(lines, m.csrline+1)
+		m.replaceLines(lines, m.csrline)
+		m.LineEditor.Cursor = readline.MojiCountInString(upper)
+		return true
+	}
+	return readline.ENTER
+}
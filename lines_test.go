@@ -0,0 +1,36 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestMoveLines(t *testing.T) {
+	keyin := strings.Split("a\rb\rc\rd", "")
+	// Move `d` to the top
+	keyin = append(keyin, keyAltUp, keyAltUp, keyAltUp)
+	// Select `a` and `b` and move them up. The last line `c` cannot move down.
+	keyin = append(keyin, keys.Down, keys.CtrlA, keyShiftDown, keyShiftDown, keyAltUp)
+	keyin = append(keyin, keys.Down, keyAltDown, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "a\nb\nd\nc"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestDuplicateAndJoinLine(t *testing.T) {
+	keyin := strings.Split("SELECT *  \r   FROM DUAL", "")
+	keyin = append(keyin, keys.CtrlX, "d", "x", keys.Up, keys.Up, keys.Escape+"^", "!", keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "SELECT *! FROM DUAL\n   FROM DUALx"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
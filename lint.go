@@ -0,0 +1,238 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// Severity is the level of Diagnostic.
+type Severity int
+
+const (
+	SeverityError Severity = iota
+	SeverityWarning
+	SeverityInfo
+)
+
+// severityStyles are the marks in the gutter and the sequences
+// to underline the ranges for each Severity.
+var severityStyles = [...]struct {
+	mark      string
+	color     string
+	underline string
+}{
+	SeverityError:   {mark: "E", color: "\x1B[31m", underline: "\x1B[4;31m"},
+	SeverityWarning: {mark: "W", color: "\x1B[33m", underline: "\x1B[4;33m"},
+	SeverityInfo:    {mark: "I", color: "\x1B[36m", underline: "\x1B[4;36m"},
+}
+
+func (s Severity) style() int {
+	if s < 0 || int(s) >= len(severityStyles) {
+		return int(SeverityError)
+	}
+	return int(s)
+}
+
+// Diagnostic is a problem in the lines found by Linter.
+type Diagnostic struct {
+	Line     int // the index of the line starting from 0
+	Start    int // the column (the count of characters) where the range starts
+	End      int // the column where the range ends. When End <= Start, the range continues to the end of the line
+	Severity Severity
+	Message  string
+}
+
+// Linter checks the lines while they are edited.
+// Lint is called in another goroutine and ctx is canceled
+// when the lines are changed again.
+type Linter interface {
+	Lint(ctx context.Context, lines []string) []Diagnostic
+}
+
+// LinterFunc is the adapter to use a function as Linter.
+type LinterFunc func(ctx context.Context, lines []string) []Diagnostic
+
+func (f LinterFunc) Lint(ctx context.Context, lines []string) []Diagnostic {
+	return f(ctx, lines)
+}
+
+const defaultLintDelay = 300 * time.Millisecond
+
+func (m *Editor) lintDelay() time.Duration {
+	if m.LintDelay <= 0 {
+		return defaultLintDelay
+	}
+	return m.LintDelay
+}
+
+// startLint prepares to run Linter during Read.
+// The returned function stops it.
+func (m *Editor) startLint(ctx context.Context) func() {
+	m.diagnostics = nil
+	m.lintSource = ""
+	var cancel context.CancelFunc
+	m.lintContext, cancel = context.WithCancel(ctx)
+	m.lintCancel = func() {}
+	m.requestLint()
+	return func() {
+		cancel()
+		m.diagnostics = nil
+	}
+}
+
+// requestLint calls Linter for the current lines after LintDelay
+// when they are changed. The call for the previous lines is canceled.
+// m.mutex must be locked.
+func (m *Editor) requestLint() {
+	if m.Linter == nil {
+		return
+	}
+	source := strings.Join(m.lines, "\n")
+	if source == m.lintSource {
+		return
+	}
+	m.lintSource = source
+	m.lintCancel()
+	var ctx context.Context
+	ctx, m.lintCancel = context.WithCancel(m.lintContext)
+	lines := append([]string{}, m.lines...)
+	delay := m.lintDelay()
+
+	go func() {
+		timer := time.NewTimer(delay)
+		defer timer.Stop()
+		select {
+		case <-ctx.Done():
+			return
+		case <-timer.C:
+		}
+		diagnostics := m.Linter.Lint(ctx, lines)
+
+		m.mutex.Lock()
+		defer m.mutex.Unlock()
+		if ctx.Err() != nil {
+			return
+		}
+		m.diagnostics = diagnostics
+		if m.commandRunning {
+			// AfterCommand repaints them.
+			m.lintUpdated = true
+		} else {
+			m.repaintDiagnostics()
+		}
+	}()
+}
+
+// repaintDiagnostics prints the lines with the new diagnostics
+// while waiting for a key.
+func (m *Editor) repaintDiagnostics() {
+	if m.repaintCursorLine == nil {
+		return
+	}
+	m.repaintVisibleLines()
+	m.clearMessage()
+	m.showDiagnostic()
+	m.drawStatusLine(m.statusCursor)
+	// go-readline-ny prints the prompt with the gutter and the cursor line.
+	m.repaintCursorLine()
+	m.LineEditor.Out.Flush()
+}
+
+// diagnosticsInLine returns the diagnostics of the line i.
+func (m *Editor) diagnosticsInLine(i int) []Diagnostic {
+	var result []Diagnostic
+	for _, d := range m.diagnostics {
+		if d.Line == i {
+			result = append(result, d)
+		}
+	}
+	return result
+}
+
+// gutterMark returns the mark printed before the prompt of the line i.
+func (m *Editor) gutterMark(i int) string {
+	diagnostics := m.diagnosticsInLine(i)
+	if len(diagnostics) <= 0 {
+		return " "
+	}
+	severity := diagnostics[0].Severity.style()
+	for _, d := range diagnostics[1:] {
+		severity = min(severity, d.Severity.style())
+	}
+	style := severityStyles[severity]
+	return style.color + style.mark + resetSGR + m.ResetColor
+}
+
+// writePrompt prints the prompt of the line i with the gutter for Linter.
+func (m *Editor) writePrompt(w io.Writer, i int) (int, error) {
+	if m.Linter == nil {
+		return m.prompt(w, i)
+	}
+	var buffer strings.Builder
+	m.prompt(&buffer, i)
+	s := buffer.String()
+	j := strings.LastIndexByte(s, '\n') + 1
+	return io.WriteString(w, s[:j]+m.gutterMark(i)+s[j:])
+}
+
+// diagnosticOverlays returns the underlines for the diagnostics of the line i
+// whose text is s. The cursor line is not underlined because the columns
+// move while it is edited.
+func (m *Editor) diagnosticOverlays(i int, s string) []overlay {
+	if i == m.csrline {
+		return nil
+	}
+	var result []overlay
+	for _, d := range m.diagnosticsInLine(i) {
+		start := mojiOffset(s, d.Start)
+		end := len(s)
+		if d.End > d.Start {
+			end = mojiOffset(s, d.End)
+		}
+		if start >= end {
+			// mark the position at the end of the line
+			end = start + 1
+		}
+		result = append(result, overlay{start: start, end: end, seq: severityStyles[d.Severity.style()].underline})
+	}
+	return result
+}
+
+// lintInEditing calls Linter for the lines changed by the command
+// and shows the message for the cursor line.
+func (m *Editor) lintInEditing(B *readline.Buffer) {
+	if m.Linter == nil {
+		return
+	}
+	m.Sync(B.String())
+	m.requestLint()
+	if !m.messageDrawn && m.cursorLineDiagnostic() != "" {
+		m.up(0)
+		m.showDiagnostic()
+		moveToCursor(B)
+	}
+}
+
+// cursorLineDiagnostic returns the message of the diagnostic of the cursor line.
+func (m *Editor) cursorLineDiagnostic() string {
+	if diagnostics := m.diagnosticsInLine(m.csrline); len(diagnostics) > 0 {
+		return diagnostics[0].Message
+	}
+	return ""
+}
+
+// showDiagnostic prints the message of the diagnostic of the cursor line
+// below the lines. With StatusLine, it is given as Status.Message instead.
+// The cursor of the screen must be at the top of the line `m.csrline`.
+func (m *Editor) showDiagnostic() {
+	if m.messageDrawn || (m.StatusLine != nil && m.StatusLineHeight > 0) {
+		return
+	}
+	if msg := m.cursorLineDiagnostic(); msg != "" {
+		m.showMessage(msg)
+	}
+}
@@ -0,0 +1,57 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestLinter(t *testing.T) {
+	keyin := strings.Split("ab?c\rdef", "")
+	keyin = append(keyin, keys.CtrlJ)
+
+	ed := Editor{LintDelay: time.Millisecond}
+	ed.Linter = LinterFunc(func(_ context.Context, lines []string) []Diagnostic {
+		var result []Diagnostic
+		for i, s := range lines {
+			if j := strings.Index(s, "?"); j >= 0 {
+				result = append(result, Diagnostic{Line: i, Start: j, End: j + 1, Message: "unexpected ?"})
+			}
+		}
+		return result
+	})
+	var diagnostics []Diagnostic
+	var gutter string
+	ed.LineEditor.Tty = &auto.Pilot{
+		Text: keyin,
+		OnGetKey: func(p *auto.Pilot) error {
+			if len(p.Text) > 1 {
+				return nil
+			}
+			// wait for the linter before the last key
+			for i := 0; i < 100 && diagnostics == nil; i++ {
+				time.Sleep(10 * time.Millisecond)
+				ed.mutex.Lock()
+				diagnostics = ed.diagnostics
+				gutter = ed.gutterMark(0) + ed.gutterMark(1)
+				ed.mutex.Unlock()
+			}
+			return nil
+		},
+	}
+	ed.SetWriter(io.Discard)
+	if _, err := ed.Read(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+	if len(diagnostics) != 1 || diagnostics[0].Line != 0 || diagnostics[0].Start != 2 {
+		t.Fatalf("unexpected diagnostics: %#v", diagnostics)
+	}
+	if expect := severityStyles[SeverityError].color + "E" + resetSGR + " "; gutter != expect {
+		t.Fatalf("expect gutter %#v, but %#v", expect, gutter)
+	}
+}
@@ -7,8 +7,8 @@ import (
 	"fmt"
 	"io"
 	"strings"
-
-	"github.com/mattn/go-runewidth"
+	"sync"
+	"time"
 
 	"github.com/nyaosorg/go-readline-ny"
 	"github.com/nyaosorg/go-readline-ny/keys"
@@ -38,6 +38,148 @@ type Editor struct {
 
 	memoHighlightSource string
 	memoHighlightResult *readline.HighlightColorSequence
+
+	undo  undoJournal
+	ctrlX *PrefixCommand
+
+	// RegionColor is the sequence to draw the selected region.
+	// When it is empty, the reverse video is used.
+	RegionColor string
+	mark        position
+	markActive  bool
+	markShifted bool // the mark was set by Shift+arrow keys
+	shiftMoved  bool
+	keepRegion  bool // the last command changed the text but keeps the region
+
+	// MatchingBracketColor is the sequence to draw the bracket at the cursor
+	// and its partner. When it is empty, they are not drawn.
+	MatchingBracketColor string
+	overlayDrawn         bool
+
+	// KillRingMax is the maximum count of entries in the kill ring.
+	// When it is zero, 60 is used.
+	KillRingMax int
+
+	// KillRingNoClipboard keeps the kill ring away from LineEditor.Clipboard.
+	// Without it, the killed text is written into the clipboard, and
+	// the text copied into it by the other applications is pushed into
+	// the kill ring on yank.
+	KillRingNoClipboard bool
+
+	killRing    []string
+	yankIndex   int
+	yankStart   position
+	yankEnd     position
+	thisCommand commandKind
+	lastCommand commandKind
+	goal        int // the display column kept by vertical movement
+
+	// Indenter returns the indent string for the new line made by NewLine.
+	// lines are all lines, and the new line is made at the column col
+	// (the count of characters) of lines[csrline].
+	// When it is nil, the new line is not indented.
+	Indenter func(lines []string, csrline, col int) string
+
+	// SoftWrap makes the lines longer than the width of the terminal use
+	// as many rows as they need instead of being truncated.
+	// The cursor line is not wrapped and scrolls horizontally,
+	// so Up and Down move the cursor by lines, not by the rows of them.
+	SoftWrap bool
+
+	// WrapMarker is printed at the end of the wrapped rows.
+	// When it is empty, "\\" is used.
+	WrapMarker string
+	wrapAll    bool // the cursor line is also wrapped after submitting
+
+	// OnResize is called with the new size of the terminal
+	// after the lines are printed again for it.
+	OnResize func(width, height int)
+	mutex    sync.Mutex
+
+	// LineComment is the prefix to comment out lines (e.g. "-- ", "; ", "# ")
+	// used by CmdToggleComment.
+	LineComment string
+
+	// BlockComment is the pair of the delimiters to comment out lines
+	// (e.g. [2]string{"/*", "*/"}) used when LineComment is empty.
+	BlockComment [2]string
+
+	// ExpandTabs makes Tab, the indent commands and the indent of
+	// the new line made by NewLine use spaces instead of tabs.
+	// The tab stops are every 4 columns as go-readline-ny prints them.
+	ExpandTabs bool
+
+	// StatusLine writes the rows reserved by StatusLineHeight separated by "\n".
+	// Each row must not be wider than status.Width.
+	// When it is nil, the rows are left blank.
+	StatusLine         func(w io.Writer, status Status)
+	statusMessage      string
+	statusMessageFresh bool
+	statusCursor       int
+
+	// Validate is called by Submit. When it returns an error, the lines are
+	// not submitted and the message of the error is shown until the next key.
+	// When the error is (or wraps) *ValidationError, the cursor moves to
+	// the position it tells.
+	Validate     func(lines []string) error
+	messageDrawn bool
+
+	// Linter checks the lines in another goroutine after they are not changed
+	// for LintDelay (300ms when it is zero). The diagnostics are drawn as the marks
+	// before the prompt, as the underlines in the lines except the cursor line
+	// and as the message for the cursor line.
+	Linter            Linter
+	LintDelay         time.Duration
+	diagnostics       []Diagnostic
+	lintSource        string
+	lintContext       context.Context
+	lintCancel        context.CancelFunc
+	lintUpdated       bool // the diagnostics were updated while a command was running
+	commandRunning    bool
+	repaintCursorLine func()
+
+	// ISearchMatchColor is the sequence to draw the matched string in the
+	// incremental search and the selected entry of the history picker.
+	// When it is empty, the reverse video is used.
+	ISearchMatchColor string
+
+	// PinnedMark is printed before the pinned entries listed by
+	// the history picker. When it is empty, "* " is used.
+	PinnedMark string
+
+	// MenuColor and MenuSelectedColor are the sequences to draw the items
+	// of PopupMenu and the selected one. When they are empty, black on white
+	// and bold white on blue are used.
+	MenuColor         string
+	MenuSelectedColor string
+
+	// HistoryFilter selects the entries of the history fetched by
+	// CmdPreviousHistory, CmdNextHistory and the incremental search.
+	// When LineEditor.History implements RichHistory, the entries have
+	// their information. When it is nil, all entries are used.
+	// The entries pinned in EditableHistory are always used.
+	HistoryFilter func(HistoryEntry) bool
+
+	// HistoryPolicy tells which entries AddHistory and AddHistoryEntry add to the history.
+	HistoryPolicy HistoryPolicy
+
+	// HistorySearchSubstring makes CmdHistorySearchBackward and
+	// CmdHistorySearchForward fetch the entries containing the typed lines
+	// instead of the ones starting with them.
+	HistorySearchSubstring bool
+	// HistorySearchOnUpDown makes Up at the first line and Down at the last line
+	// search the history with the typed lines instead of fetching every entry.
+	HistorySearchOnUpDown bool
+	historyQuery          string
+
+	// Predictor suggests the text following the lines while the cursor is at
+	// the end of the last line. The suggestion is drawn with SuggestionColor
+	// after the cursor and in the rows below the cursor line.
+	Predictor       Predictor
+	SuggestionColor string
+	suggestion      string
+	suggestionTop   int // the row of the suggestion below the cursor line
+	suggestionRows  int
 }
 
 func (m *Editor) SetTty(tty ttyadapter.Tty)                     { m.LineEditor.Tty = tty }
@@ -103,35 +245,32 @@ func (m *Editor) up(n int) {
 }
 
 func (m *Editor) CmdPreviousLine(ctx context.Context, rl *readline.Buffer) readline.Result {
+	if m.HistorySearchOnUpDown && (m.csrline <= 0 || m.lastCommand == cmdHistorySearch) {
+		return m.CmdHistorySearchBackward(ctx, rl)
+	}
 	if m.csrline <= 0 {
 		return m.CmdPreviousHistory(ctx, rl)
 	}
+	goal := m.goalColumn(rl)
 	m.after = func(line string) bool {
 		m.Sync(line)
-		m.csrline--
-		if m.adjustHeadline() < 0 {
-			m.up(m.PrintFromLine(m.csrline))
-		} else {
-			fmt.Fprint(m.LineEditor.Out, "\x1B[1F")
-		}
+		m.moveCursorLine(m.csrline - 1)
+		m.LineEditor.Cursor = m.columnToCursor(m.lines[m.csrline], goal)
 		return true
 	}
 	return readline.ENTER
 }
 
 func (m *Editor) GotoEndLine() func() {
-	end := min(len(m.lines), m.headline+m.viewHeight)
-	if end < 1 {
-		end = 1
-	}
+	end := m.visibleRows()
 	lfCount := 0
-	for i := m.csrline; i < end; i++ {
+	for i := m.cursorRow(); i < end; i++ {
 		fmt.Fprintln(m.LineEditor.Out)
 		lfCount++
 	}
 	m.LineEditor.Out.Flush()
 	return func() {
-		if len(m.lines) >= m.viewHeight {
+		if m.rowsBetween(0, len(m.lines)) >= m.viewHeight {
 			io.WriteString(m.LineEditor.Out, "\x1B[1;1H")
 			m.PrintFromLine(m.headline)
 			if lfCount > 1 {
@@ -147,6 +286,18 @@ func (m *Editor) GotoEndLine() func() {
 func (m *Editor) Submit(_ context.Context, B *readline.Buffer) readline.Result {
 	m.after = func(line string) bool {
 		m.Sync(line)
+		if !m.validate() {
+			return true
+		}
+		if m.overlayDrawn {
+			m.markActive = false
+			m.overlayDrawn = false
+			m.repaintVisibleLines()
+		}
+		if m.SoftWrap {
+			m.relayout(func() { m.wrapAll = true })
+		}
+		m.clearStatusLine()
 		m.GotoEndLine()
 		return false
 	}
@@ -154,6 +305,13 @@ func (m *Editor) Submit(_ context.Context, B *readline.Buffer) readline.Result {
 }
 
 func (m *Editor) CmdNextLine(ctx context.Context, rl *readline.Buffer) readline.Result {
+	if m.HistorySearchOnUpDown && (m.csrline >= len(m.lines)-1 || m.lastCommand == cmdHistorySearch) {
+		if m.CmdHistorySearchForward(ctx, rl) == readline.CONTINUE {
+			return readline.CONTINUE
+		}
+		m.after = m.printCurrentHistoryRecordAndGoToTop
+		return readline.ENTER
+	}
 	if m.csrline >= len(m.lines)-1 {
 		if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
 			return readline.CONTINUE
@@ -165,15 +323,11 @@ func (m *Editor) CmdNextLine(ctx context.Context, rl *readline.Buffer) readline.
 		m.after = m.printCurrentHistoryRecordAndGoToTop
 		return readline.ENTER
 	}
+	goal := m.goalColumn(rl)
 	m.after = func(line string) bool {
 		m.Sync(line)
-		m.csrline++
-		if m.adjustHeadline() > 0 {
-			m.up(m.csrline - m.headline)
-			m.PrintFromLine(m.headline)
-		} else {
-			fmt.Fprintln(m.LineEditor.Out)
-		}
+		m.moveCursorLine(m.csrline + 1)
+		m.LineEditor.Cursor = m.columnToCursor(m.lines[m.csrline], goal)
 		return true
 	}
 	return readline.ENTER
@@ -188,12 +342,7 @@ func (m *Editor) CmdBackwardChar(ctx context.Context, b *readline.Buffer) readli
 	}
 	m.after = func(line string) bool {
 		m.Sync(line)
-		m.csrline--
-		if m.adjustHeadline() < 0 {
-			m.up(m.PrintFromLine(m.csrline))
-		} else {
-			fmt.Fprint(m.LineEditor.Out, "\x1B[1F")
-		}
+		m.moveCursorLine(m.csrline - 1)
 		m.LineEditor.Cursor = readline.MojiCountInString(m.lines[m.csrline])
 		return true
 	}
@@ -205,19 +354,16 @@ func (m *Editor) CmdForwardChar(ctx context.Context, b *readline.Buffer) readlin
 		return readline.CmdForwardChar.Call(ctx, b)
 	}
 	if m.csrline+1 >= len(m.lines) {
+		if m.suggestion != "" && b.Cursor >= len(b.Buffer) {
+			return m.CmdAcceptSuggestion(ctx, b)
+		}
 		// To complete with the string of prediction
 		return readline.CmdForwardChar.Call(ctx, b)
 	}
 	m.after = func(line string) bool {
 		m.Sync(line)
-		m.csrline++
+		m.moveCursorLine(m.csrline + 1)
 		m.LineEditor.Cursor = 0
-		if m.adjustHeadline() > 0 {
-			m.up(m.csrline - m.headline)
-			m.PrintFromLine(m.headline)
-		} else {
-			fmt.Fprint(m.LineEditor.Out, "\n")
-		}
 		return true
 	}
 	return readline.ENTER
@@ -226,7 +372,7 @@ func (m *Editor) CmdForwardChar(ctx context.Context, b *readline.Buffer) readlin
 // clearAfterPrintAfter is the function instead of `\x1B[J`
 // for the JetBrains IDE terminal
 func (m *Editor) clearAfterPrintAfter() {
-	if len(m.lines) < m.headline+m.viewHeight {
+	if m.rowsBetween(m.headline, len(m.lines)) < m.viewHeight {
 		// Cursor line is last line
 		if m.csrline == len(m.lines)-1 {
 			io.WriteString(m.LineEditor.Out, "\r\x1B[K")
@@ -250,14 +396,21 @@ func (m *Editor) CmdBackwardDeleteChar(ctx context.Context, b *readline.Buffer)
 	}
 	m.after = func(line string) bool {
 		if m.csrline > 0 {
-			m.csrline--
-			m.adjustHeadline()
-			m.LineEditor.Cursor = readline.MojiCountInString(m.lines[m.csrline])
-			m.lines[m.csrline] = m.lines[m.csrline] + line
-			m.Dirty = true
-			if m.csrline+1 < len(m.lines) {
-				m.lines = deleteSliceAt(m.lines, m.csrline+1)
+			join := func() {
+				m.csrline--
+				m.LineEditor.Cursor = readline.MojiCountInString(m.lines[m.csrline])
+				m.lines[m.csrline] = m.lines[m.csrline] + line
+				m.Dirty = true
+				if m.csrline+1 < len(m.lines) {
+					m.lines = deleteSliceAt(m.lines, m.csrline+1)
+				}
 			}
+			if m.SoftWrap {
+				m.relayout(join)
+				return true
+			}
+			join()
+			m.adjustHeadline()
 			io.WriteString(m.LineEditor.Out, "\r")
 			lfCount := m.PrintFromLine(m.csrline + 1)
 			m.clearAfterPrintAfter()
@@ -269,25 +422,42 @@ func (m *Editor) CmdBackwardDeleteChar(ctx context.Context, b *readline.Buffer)
 }
 
 func (m *Editor) NewLine(_ context.Context, b *readline.Buffer) readline.Result {
-	// make new line at the next of the cursor
-	if m.csrline >= len(m.lines) {
-		m.lines = append(m.lines, "")
+	rest := b.SubString(b.Cursor, len(b.Buffer))
+	indent := ""
+	if m.Indenter != nil {
+		m.Sync(b.String())
+		indent = m.Indenter(m.lines, m.csrline, b.Cursor)
+		if m.ExpandTabs {
+			indent = expandTabs(indent)
+		}
+		rest = strings.TrimLeft(rest, " \t")
 	}
-	m.lines = append(m.lines, "")
-	copy(m.lines[m.csrline+2:], m.lines[m.csrline+1:])
 
-	// move characters after cursor to the nextline
-	m.lines[m.csrline+1] = b.SubString(b.Cursor, len(b.Buffer))
 	b.Buffer = b.Buffer[:b.Cursor]
-	m.Dirty = true
-
 	b.RepaintAll()
 
 	m.after = func(line string) bool {
+		insert := func() {
+			// make new line at the next of the cursor
+			if m.csrline >= len(m.lines) {
+				m.lines = append(m.lines, "")
+			}
+			m.lines = append(m.lines, "")
+			copy(m.lines[m.csrline+2:], m.lines[m.csrline+1:])
+
+			// move characters after cursor to the nextline
+			m.lines[m.csrline+1] = indent + rest
+			m.Dirty = true
+			m.Sync(line)
+			m.csrline++
+		}
+		m.LineEditor.Cursor = readline.MojiCountInString(indent)
+		if m.SoftWrap {
+			m.relayout(insert)
+			return true
+		}
 		io.WriteString(m.LineEditor.Out, "\n")
-		m.Sync(line)
-		m.LineEditor.Cursor = 0
-		m.csrline++
+		insert()
 		m.adjustHeadline()
 		m.up(m.PrintFromLine(m.csrline))
 		return true
@@ -308,7 +478,14 @@ func (m *Editor) CmdDeleteChar(ctx context.Context, b *readline.Buffer) readline
 	if b.Cursor < len(b.Buffer) {
 		return readline.CmdDeleteOrAbort.Call(ctx, b)
 	}
-	if m.csrline+1 < len(m.lines) {
+	if m.csrline+1 < len(m.lines) && m.SoftWrap {
+		b.InsertString(b.Cursor, m.lines[m.csrline+1])
+		m.Sync(b.String())
+		m.relayout(func() {
+			m.lines = deleteSliceAt(m.lines, m.csrline+1)
+		})
+		b.RepaintLastLine()
+	} else if m.csrline+1 < len(m.lines) {
 		b.InsertString(b.Cursor, m.lines[m.csrline+1])
 		b.RepaintAfterPrompt()
 		m.lines = deleteSliceAt(m.lines, m.csrline+1)
@@ -379,7 +556,13 @@ func printLastLine(p string, w io.Writer) {
 	}
 }
 
-func (m *Editor) newPrinter() func(i int) {
+type lineColor struct {
+	maps  []readline.EscapeSequenceId
+	start readline.EscapeSequenceId
+}
+
+// lineColors returns the colors of each line calculated by m.Highlight
+func (m *Editor) lineColors() []lineColor {
 	var colSeq *readline.HighlightColorSequence
 	src := strings.Join(m.lines, "\n")
 
@@ -396,16 +579,12 @@ func (m *Editor) newPrinter() func(i int) {
 		m.memoHighlightResult = colSeq
 	}
 
-	type LineColor struct {
-		maps  []readline.EscapeSequenceId
-		start readline.EscapeSequenceId
-	}
-	lineColors := []LineColor{}
+	lineColors := []lineColor{}
 	color := readline.NewEscapeSequenceId(m.ResetColor)
 	colorMap := colSeq.ColorMap
 
 	for i := 0; i < len(m.lines); i++ {
-		lineColor1 := LineColor{
+		lineColor1 := lineColor{
 			maps:  colorMap[:len(m.lines[i])],
 			start: color,
 		}
@@ -417,10 +596,18 @@ func (m *Editor) newPrinter() func(i int) {
 		color = colorMap[len(m.lines[i])]
 		colorMap = colorMap[len(m.lines[i])+1:]
 	}
+	return lineColors
+}
 
-	return func(i int) {
+// newPrinter returns the function which prints the line i
+// with at most maxRows rows and returns the count of the rows printed.
+func (m *Editor) newPrinter() func(i, maxRows int) int {
+	lineColors := m.lineColors()
+	overlaysInLine := m.newOverlays()
+
+	return func(i, maxRows int) int {
 		var buffer strings.Builder
-		m.prompt(&buffer, i)
+		m.writePrompt(&buffer, i)
 		promptStr := buffer.String()
 		if i != 0 || m.promptLastLineOnly {
 			printLastLine(promptStr, m.LineEditor.Out)
@@ -431,44 +618,65 @@ func (m *Editor) newPrinter() func(i int) {
 
 		w0 := int(readline.GetStringWidth(cutEscapeSequenceAndOldLine(promptStr)))
 		w := w0
+		rows := 1
+		wrap := m.wraps(i)
 
 		color := lineColors[i].start
 		colorMap := lineColors[i].maps
 		color.WriteTo(m.LineEditor.Out)
 
+		overlays := overlaysInLine(i, m.lines[i])
+		selected := ""
+
 		for j, c := range m.lines[i] {
 			newColor := colorMap[j]
-			if newColor != color {
+			if seq := overlayAt(overlays, j); seq != "" {
+				if seq != selected {
+					io.WriteString(m.LineEditor.Out, resetSGR+seq)
+					selected = seq
+				}
+			} else if selected != "" {
+				io.WriteString(m.LineEditor.Out, resetSGR)
+				newColor.WriteTo(m.LineEditor.Out)
+				selected = ""
+			} else if newColor != color {
 				newColor.WriteTo(m.LineEditor.Out)
 			}
 			color = newColor
-			if c == '\t' {
-				size := 4 - (w-w0)%4
-				if w+size >= m.viewWidth-forbiddenWidth {
+			size := m.charWidth(c, w, w0)
+			if w+size >= m.viewWidth-forbiddenWidth {
+				if !wrap || rows >= maxRows {
 					break
 				}
-				io.WriteString(m.LineEditor.Out, "    "[:size])
-				w += size
-			} else if c < 0x20 {
-				if w+2 >= m.viewWidth-forbiddenWidth {
-					break
+				io.WriteString(m.LineEditor.Out, resetSGR+m.wrapMarker()+"\x1B[K\n")
+				io.WriteString(m.LineEditor.Out, strings.Repeat(" ", w0))
+				if selected != "" {
+					io.WriteString(m.LineEditor.Out, selected)
+				} else {
+					color.WriteTo(m.LineEditor.Out)
 				}
+				rows++
+				w = w0
+				size = m.charWidth(c, w, w0)
+			}
+			if c == '\t' {
+				io.WriteString(m.LineEditor.Out, strings.Repeat(" ", size))
+			} else if c < 0x20 {
 				m.LineEditor.Out.Write([]byte{'^', '@' + byte(c)})
-				w += 2
 			} else {
-				w1 := runewidth.RuneWidth(c)
-				if w+w1 >= m.viewWidth-forbiddenWidth {
-					break
-				}
 				m.LineEditor.Out.WriteRune(c)
-				w += w1
 			}
+			w += size
+		}
+		if selected != "" {
+			io.WriteString(m.LineEditor.Out, resetSGR)
 		}
 		if m.OnAfterRender != nil {
 			m.OnAfterRender(m.LineEditor.Out, m.viewWidth-forbiddenWidth-w)
 		}
 		io.WriteString(m.LineEditor.Out, m.ResetColor)
 		io.WriteString(m.LineEditor.Out, "\x1B[K")
+		return rows
 	}
 }
 
@@ -477,16 +685,16 @@ func (m *Editor) newPrinter() func(i int) {
 // It does not fix view.
 func (m *Editor) printFromTo(i, j int) int {
 	lfCount := 0
-	if j > m.headline+m.viewHeight {
-		j = m.headline + m.viewHeight
-	}
-	if i < j {
+	rows := m.viewHeight - m.rowsBetween(m.headline, i)
+	if i < j && rows > 0 {
 		m.LineEditor.Out.WriteByte('\r')
 		printOne := m.newPrinter()
 		for {
-			printOne(i)
+			n := printOne(i, rows)
+			lfCount += n - 1
+			rows -= n
 			i++
-			if i >= j {
+			if i >= j || rows <= 0 {
 				break
 			}
 			m.LineEditor.Out.WriteByte('\n')
@@ -509,33 +717,99 @@ func (m *Editor) PrintFromLine(i int) int {
 	return lfCount
 }
 
+// repaintVisibleLines prints all lines on the screen again
+// and moves the cursor to the top of the cursor line.
+func (m *Editor) repaintVisibleLines() {
+	m.up(m.cursorRow())
+	lfCount := m.PrintFromLine(m.headline)
+	m.up(lfCount - m.cursorRow())
+}
+
+// relayout erases the lines on the screen, calls update which may change
+// the lines and the cursor line, and prints the visible lines again.
+// The cursor of the screen must be on the line `m.csrline`.
+func (m *Editor) relayout(update func()) {
+	m.clearLines()
+	update()
+	m.adjustHeadline()
+	lfCount := m.PrintFromLine(m.headline)
+	m.up(lfCount - m.cursorRow())
+}
+
 func (m *Editor) repaint(_ context.Context, b *readline.Buffer) readline.Result {
 	io.WriteString(m.LineEditor.Out, "\x1B[1;1H\x1B[2J")
+	m.messageDrawn = false
+	m.suggestionRows = 0
 	lfCount := m.PrintFromLine(m.headline)
-	lfCount -= (m.csrline - m.headline)
+	lfCount -= m.cursorRow()
 	m.up(lfCount)
+	m.drawStatusLine(b.Cursor)
 	b.RepaintAll()
 	return readline.CONTINUE
 }
 
 // adjustHeadline calculates the new value of m.headline
 func (m *Editor) adjustHeadline() int {
-	if m.csrline >= m.headline+m.viewHeight {
-		m.headline = m.csrline - m.viewHeight + 1
-		return +1
-	} else if m.csrline < m.headline {
+	if m.csrline < m.headline {
 		m.headline = m.csrline
 		return -1
+	} else if m.cursorRow() >= m.viewHeight {
+		if !m.SoftWrap {
+			m.headline = m.csrline - m.viewHeight + 1
+		}
+		for m.headline < m.csrline && m.cursorRow() >= m.viewHeight {
+			m.headline++
+		}
+		return +1
 	}
 	return 0
 }
 
+// moveCursorLine moves the cursor of the screen to the line csrline
+// scrolling the view if necessary.
+// The cursor of the screen must be on the line `m.csrline`.
+func (m *Editor) moveCursorLine(csrline int) {
+	if m.SoftWrap {
+		m.moveWrappedCursorLine(csrline)
+		return
+	}
+	oldRow := m.cursorRow()
+	m.csrline = csrline
+	if m.adjustHeadline() != 0 {
+		m.up(oldRow)
+		lfCount := m.PrintFromLine(m.headline)
+		m.up(lfCount - m.cursorRow())
+		return
+	}
+	if d := m.cursorRow() - oldRow; d > 0 {
+		fmt.Fprintf(m.LineEditor.Out, "\x1B[%dE", d)
+	} else {
+		m.up(-d)
+	}
+}
+
+// moveCursorTo moves the cursor to pos which may be on another line.
+func (m *Editor) moveCursorTo(b *readline.Buffer, pos position) readline.Result {
+	if pos.line == m.csrline {
+		b.Cursor = pos.col
+		b.RepaintAfterPrompt()
+		return readline.CONTINUE
+	}
+	m.after = func(line string) bool {
+		m.Sync(line)
+		m.moveCursorLine(pos.line)
+		m.LineEditor.Cursor = pos.col
+		return true
+	}
+	return readline.ENTER
+}
+
 func (m *Editor) clearLines() {
-	end := min(len(m.lines), m.headline+m.viewHeight) - 1
-	if end > m.csrline {
-		fmt.Fprintf(m.LineEditor.Out, "\x1B[%dE", end-m.csrline)
+	end := m.visibleRows() - 1
+	if row := m.cursorRow(); end > row {
+		fmt.Fprintf(m.LineEditor.Out, "\x1B[%dE", end-row)
 	}
-	for i := end; i > m.headline; i-- {
+	for i := end; i > 0; i-- {
 		io.WriteString(m.LineEditor.Out, "\x1B[2K\x1B[F")
 	}
 	io.WriteString(m.LineEditor.Out, "\x1B[2K")
@@ -556,7 +830,7 @@ func (m *Editor) _printCurrentHistoryRecord(tail bool) {
 	}
 	m.adjustHeadline()
 	lfCount := m.PrintFromLine(m.headline)
-	lfCount -= (m.csrline - m.headline)
+	lfCount -= m.cursorRow()
 	m.up(lfCount)
 	m.LineEditor.Cursor = 9999
 }
@@ -584,15 +858,15 @@ func (m *Editor) CmdPreviousHistory(_ context.Context, b *readline.Buffer) readl
 	if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
 		return readline.CONTINUE
 	}
-	m.saveModfiedHistory(b)
-	if m.historyPtr <= 0 {
-		if !m.LineEditor.HistoryCycling {
+	prev := m.previousHistory(m.historyPtr)
+	if prev < 0 {
+		if !m.LineEditor.HistoryCycling || m.historyPtr >= m.LineEditor.History.Len() {
 			return readline.CONTINUE
 		}
-		m.historyPtr = m.LineEditor.History.Len()
-	} else {
-		m.historyPtr--
+		prev = m.LineEditor.History.Len()
 	}
+	m.saveModfiedHistory(b)
+	m.historyPtr = prev
 	m.after = m.printCurrentHistoryRecord
 	return readline.ENTER
 }
@@ -601,14 +875,19 @@ func (m *Editor) CmdNextHistory(_ context.Context, b *readline.Buffer) readline.
 	if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
 		return readline.CONTINUE
 	}
-	m.saveModfiedHistory(b)
-	if m.historyPtr >= m.LineEditor.History.Len() {
+	next := m.historyPtr
+	if next >= m.LineEditor.History.Len() {
 		if !m.LineEditor.HistoryCycling {
 			return readline.CONTINUE
 		}
-		m.historyPtr = -1
+		next = -1
+	}
+	next = m.nextHistory(next)
+	if next == m.historyPtr {
+		return readline.CONTINUE
 	}
-	m.historyPtr++
+	m.saveModfiedHistory(b)
+	m.historyPtr = next
 	m.after = m.printCurrentHistoryRecord
 	return readline.ENTER
 }
@@ -629,22 +908,27 @@ func min(i, j int) int {
 	return j
 }
 
-func (m *Editor) CmdYank(_ context.Context, b *readline.Buffer) readline.Result {
-	text, err := m.LineEditor.Clipboard.Read()
-	if err != nil {
-		return readline.CONTINUE
+func max(i, j int) int {
+	if i > j {
+		return i
 	}
-	text = strings.TrimRight(text, "\r\n\000")
-	if len(text) <= 0 {
+	return j
+}
+
+// CmdYank inserts the newest entry of the kill ring (for Ctrl-Y and Meta-V).
+// When the clipboard has the other text, it is pushed into the kill ring
+// before (unless KillRingNoClipboard).
+func (m *Editor) CmdYank(_ context.Context, b *readline.Buffer) readline.Result {
+	text, ok := m.currentKill()
+	if !ok {
 		return readline.CONTINUE
 	}
-	text = strings.ReplaceAll(text, "\r\n", "\n")
+	m.thisCommand = cmdYank
+	m.yankStart = position{line: m.csrline, col: b.Cursor}
 	newlines := strings.Split(text, "\n")
-	if len(newlines) <= 0 {
-		return readline.CONTINUE
-	}
 	if len(newlines) <= 1 {
 		b.InsertAndRepaint(newlines[0])
+		m.yankEnd = position{line: m.csrline, col: b.Cursor}
 		return readline.CONTINUE
 	}
 
@@ -658,6 +942,16 @@ func (m *Editor) CmdYank(_ context.Context, b *readline.Buffer) readline.Result
 	newlines[len(newlines)-1] += tmp
 
 	m.after = func(line string) bool {
+		if m.SoftWrap {
+			m.relayout(func() {
+				m.Sync(line)
+				m.lines = insertSliceAt(m.lines, m.csrline+1, newlines)
+				m.csrline += len(newlines)
+			})
+			m.LineEditor.Cursor = readline.MojiCountInString(m.lines[m.csrline]) - nextCursorPosition
+			m.yankEnd = position{line: m.csrline, col: m.LineEditor.Cursor}
+			return true
+		}
 		m.Sync(line)
 		fmt.Fprintln(m.LineEditor.Out)
 		m.csrline++
@@ -670,6 +964,7 @@ func (m *Editor) CmdYank(_ context.Context, b *readline.Buffer) readline.Result
 		m.PrintFromLine(start)
 		m.up(min(len(m.lines), m.headline+m.viewHeight) - m.csrline - 1)
 		m.LineEditor.Cursor = readline.MojiCountInString(m.lines[m.csrline]) - nextCursorPosition
+		m.yankEnd = position{line: m.csrline, col: m.LineEditor.Cursor}
 		return true
 	}
 	return readline.ENTER
@@ -762,9 +1057,14 @@ func (m *Editor) querySize() (int, int, error) {
 }
 
 func (m *Editor) init() error {
-	if m.OnAfterRender != nil {
+	if m.OnAfterRender != nil || m.Predictor != nil {
 		m.LineEditor.OnAfterRender = func(B *readline.Buffer, availWidth int) {
-			m.OnAfterRender(B.Out, availWidth)
+			if m.OnAfterRender != nil {
+				m.OnAfterRender(B.Out, availWidth)
+			}
+			if m.Predictor != nil {
+				m.renderSuggestion(B, availWidth)
+			}
 		}
 	}
 	if m.modifiedHistoryEntry == nil {
@@ -789,13 +1089,13 @@ func (m *Editor) init() error {
 	m.LineEditor.PromptWriter = func(w io.Writer) (int, error) {
 		if m.csrline != 0 || m.promptLastLineOnly {
 			var buffer strings.Builder
-			m.prompt(&buffer, m.csrline)
+			m.writePrompt(&buffer, m.csrline)
 			promptStr := buffer.String()
 			printLastLine(promptStr, w)
 			return len(promptStr), nil
 		}
 		m.promptLastLineOnly = true
-		return m.prompt(w, m.csrline)
+		return m.writePrompt(w, m.csrline)
 	}
 
 	type ac = readline.AnonymousCommand
@@ -813,22 +1113,76 @@ func (m *Editor) init() error {
 	m.LineEditor.BindKey(keys.CtrlP, ac(m.CmdPreviousLine))
 	m.LineEditor.BindKey(keys.CtrlUp, ac(m.CmdPreviousHistory))
 	m.LineEditor.BindKey(keys.CtrlY, ac(m.CmdYank))
+	m.LineEditor.BindKey(keys.AltV, ac(m.CmdYank))
 	m.LineEditor.BindKey(keys.Delete, ac(m.CmdDeleteChar))
 	m.LineEditor.BindKey(keys.Down, ac(m.CmdNextLine))
 	m.LineEditor.BindKey(keys.Left, ac(m.CmdBackwardChar))
-	m.LineEditor.BindKey(keys.PageDown, ac(m.CmdNextHistory))
-	m.LineEditor.BindKey(keys.PageUp, ac(m.CmdPreviousHistory))
+	m.LineEditor.BindKey(keys.PageDown, ac(m.CmdPageDown))
+	m.LineEditor.BindKey(keys.PageUp, ac(m.CmdPageUp))
 	m.LineEditor.BindKey(keys.Right, ac(m.CmdForwardChar))
 	m.LineEditor.BindKey(keys.Up, ac(m.CmdPreviousLine))
 	m.LineEditor.BindKey(keys.CtrlM, ac(m.NewLine))
 	m.LineEditor.BindKey(keys.CtrlJ, ac(m.Submit))
-	m.LineEditor.BindKey(keys.CtrlR, ac(m.cmdISearchBackward))
-	m.LineEditor.BindKey(keys.CtrlS, readline.SelfInserter(keys.CtrlS))
+	m.LineEditor.BindKey(keys.CtrlR, ac(m.CmdISearchBackward))
+	m.LineEditor.BindKey(keys.CtrlS, ac(m.CmdISearchForward))
 	m.LineEditor.BindKey(keys.CtrlC, ac(m.cmdCtrlCButKeepCmdline))
-
-	m.LineEditor.BindKey(keys.Escape+"p", ac(m.CmdPreviousHistory)) // M-p: previous
-	m.LineEditor.BindKey(keys.Escape+"n", ac(m.CmdNextHistory))     // M-n: next
-	m.LineEditor.BindKey(keys.Escape+"\r", ac(m.Submit))            // M-Enter: submit
+	m.LineEditor.BindKey(keys.CtrlUnderbar, ac(m.CmdUndo))
+	m.LineEditor.BindKey(keys.CtrlZ, ac(m.CmdUndo))
+	m.LineEditor.BindKey(keyCtrlSpace, ac(m.CmdSetMark))
+	m.LineEditor.BindKey(keys.CtrlG, ac(m.CmdDeactivateMark))
+	m.LineEditor.BindKey(keys.CtrlW, ac(m.CmdKillRegion))
+	m.LineEditor.BindKey(keys.CtrlK, ac(m.CmdKillLine))
+	m.LineEditor.BindKey(keys.CtrlEnd, ac(m.CmdKillLine))
+	m.LineEditor.BindKey(keys.CtrlU, ac(m.CmdUnixLineDiscard))
+	m.LineEditor.BindKey(keys.CtrlHome, ac(m.CmdUnixLineDiscard))
+	m.LineEditor.BindKey(keys.AltD, ac(m.CmdKillWord))
+	m.LineEditor.BindKey(keys.AltBackspace, ac(m.CmdBackwardKillWord))
+	m.LineEditor.BindKey(keys.Escape+keys.CtrlW, ac(m.CmdBackwardKillWord))
+	m.LineEditor.BindKey(keys.AltY, ac(m.CmdYankPop))
+	m.LineEditor.BindKey(keys.AltF, ac(m.CmdForwardWord))
+	m.LineEditor.BindKey(keys.CtrlE, ac(m.CmdEndOfLine))
+	m.LineEditor.BindKey(keys.End, ac(m.CmdEndOfLine))
+	m.LineEditor.BindKey(keys.CtrlRight, ac(m.CmdForwardWord))
+	m.LineEditor.BindKey(keys.Escape+keys.Right, ac(m.CmdForwardWord))
+	m.LineEditor.BindKey(keys.AltB, ac(m.CmdBackwardWord))
+	m.LineEditor.BindKey(keys.CtrlLeft, ac(m.CmdBackwardWord))
+	m.LineEditor.BindKey(keys.Escape+keys.Left, ac(m.CmdBackwardWord))
+	m.LineEditor.BindKey(keyShiftUp, ac(m.CmdSelectPreviousLine))
+	m.LineEditor.BindKey(keyShiftDown, ac(m.CmdSelectNextLine))
+	m.LineEditor.BindKey(keyShiftLeft, ac(m.CmdSelectBackwardChar))
+	m.LineEditor.BindKey(keyShiftRight, ac(m.CmdSelectForwardChar))
+
+	m.LineEditor.BindKey(keys.Escape+"p", ac(m.CmdPreviousHistory))   // M-p: previous
+	m.LineEditor.BindKey(keys.Escape+"n", ac(m.CmdNextHistory))       // M-n: next
+	m.LineEditor.BindKey(keys.Escape+"\r", ac(m.Submit))              // M-Enter: submit
+	m.LineEditor.BindKey(keys.Escape+"_", ac(m.CmdRedo))              // M-_: redo
+	m.LineEditor.BindKey(keys.Escape+"w", ac(m.CmdCopyRegion))        // M-w: copy region
+	m.LineEditor.BindKey(keys.Escape+"<", ac(m.CmdBeginningOfBuffer)) // M-<: first line
+	m.LineEditor.BindKey(keys.Escape+">", ac(m.CmdEndOfBuffer))       // M->: last line
+	m.LineEditor.BindKey(keys.Escape+"^", ac(m.CmdJoinLine))          // M-^: join line
+	m.LineEditor.BindKey(keys.Escape+";", ac(m.CmdToggleComment))     // M-;: comment
+	m.LineEditor.BindKey(keys.CtrlI, ac(m.CmdInsertTab))
+	m.LineEditor.BindKey(keys.ShiftTab, ac(m.CmdDedentLines))
+	m.LineEditor.BindKey(keyAltUp, ac(m.CmdMoveLineUp))
+	m.LineEditor.BindKey(keys.Escape+keys.Up, ac(m.CmdMoveLineUp))
+	m.LineEditor.BindKey(keyAltDown, ac(m.CmdMoveLineDown))
+	m.LineEditor.BindKey(keys.Escape+keys.Down, ac(m.CmdMoveLineDown))
+
+	m.LineEditor.BindKey(keys.Escape+keys.CtrlF, ac(m.CmdForwardMatchingBracket))  // C-M-f
+	m.LineEditor.BindKey(keys.Escape+keys.CtrlB, ac(m.CmdBackwardMatchingBracket)) // C-M-b
+	m.LineEditor.BindKey(keys.Escape+keys.CtrlP, ac(m.CmdHistorySearchBackward))   // C-M-p
+	m.LineEditor.BindKey(keys.Escape+keys.CtrlN, ac(m.CmdHistorySearchForward))    // C-M-n
+
+	m.ctrlX = m.NewPrefixCommand("C-x-")
+	m.ctrlX.BindKey("u", ac(m.CmdUndo))                    // C-x u: undo
+	m.ctrlX.BindKey("d", ac(m.CmdDuplicateLine))           // C-x d: duplicate line
+	m.ctrlX.BindKey("\t", ac(m.CmdIndentLines))            // C-x Tab: indent
+	m.ctrlX.BindKey(keys.CtrlR, ac(m.CmdHistoryPicker))    // C-x C-r: history picker
+	m.ctrlX.BindKey(keys.CtrlD, ac(m.CmdRemoveHistory))    // C-x C-d: remove history
+	m.ctrlX.BindKey(keys.CtrlS, ac(m.CmdSaveHistory))      // C-x C-s: save history
+	m.ctrlX.BindKey(keys.CtrlP, ac(m.CmdTogglePinHistory)) // C-x C-p: pin history
+	m.ctrlX.BindKey(keys.CtrlK, ac(m.CmdKillWholeLine))    // C-x C-k: kill whole line
+	m.LineEditor.BindKey(keys.CtrlX, m.ctrlX)
 
 	m.LineEditor.Init()
 
@@ -895,6 +1249,14 @@ func (m *Editor) Read(ctx context.Context) ([]string, error) {
 		m.promptLastLineOnly = false
 	}()
 
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+	tty := m.LineEditor.Tty
+	m.LineEditor.Tty = &resizeTty{Tty: tty, m: m}
+	defer func() {
+		m.LineEditor.Tty = tty
+	}()
+
 	m.LineEditor.ResetColor = m.ResetColor
 	m.LineEditor.DefaultColor = m.DefaultColor
 
@@ -917,37 +1279,81 @@ func (m *Editor) Read(ctx context.Context) ([]string, error) {
 	if m.LineEditor.History != nil {
 		m.historyPtr = m.LineEditor.History.Len()
 	}
-	if len(m.Highlight) > 0 {
-		save := m.LineEditor.AfterCommand
-		// Repaint after each typing
-		m.LineEditor.AfterCommand = func(B *readline.Buffer) {
+	m.wrapAll = false
+	m.undo.reset(m.snapshot())
+	m.markActive = false
+	m.overlayDrawn = false
+	m.lastCommand = cmdOther
+	m.messageDrawn = false
+	m.commandRunning = false
+	m.suggestion = ""
+	m.suggestionTop = 0
+	m.suggestionRows = 0
+	defer m.startLint(ctx)()
+	m.drawStatusLine(m.LineEditor.Cursor)
+
+	save := m.LineEditor.AfterCommand
+	m.LineEditor.AfterCommand = func(B *readline.Buffer) {
+		m.eraseMessage(B)
+		if m.after != nil {
+			m.eraseSuggestion(B)
+		}
+		m.commandRunning = false
+		if m.after == nil {
+			// Commands that set m.after are recorded after it is called.
+			if m.undo.record(m.snapshotWith(B.String())) {
+				m.markActive = false
+			}
+		}
+		m.updateShiftSelection()
+		m.lastCommand = m.thisCommand
+		m.thisCommand = cmdOther
+		if m.after == nil && m.MatchingBracketColor != "" {
 			m.Sync(B.String())
-			m.up(m.csrline - m.headline)
-			lfCount := m.PrintFromLine(m.headline)
-			m.up(lfCount - (m.csrline - m.headline))
+		}
+		if len(m.Highlight) > 0 || (m.after == nil && (m.overlayActive() || m.overlayDrawn || m.lintUpdated)) {
+			// Repaint after each typing
+			m.Sync(B.String())
+			m.repaintVisibleLines()
 			B.RepaintLastLine()
-			if save != nil {
-				save(B)
+			if m.after == nil {
+				m.paintOverlaysInCursorLine(B)
 			}
 		}
-		defer func() {
-			m.LineEditor.AfterCommand = save
-		}()
+		if m.after == nil {
+			m.lintUpdated = false
+			m.lintInEditing(B)
+		}
+		m.expireStatusMessage()
+		if m.after == nil && m.StatusLine != nil {
+			m.Sync(B.String())
+			m.drawStatusLineInEditing(B)
+		}
+		if save != nil {
+			save(B)
+		}
 	}
+	baseHighlight := m.LineEditor.Highlight
+	defer func() {
+		m.LineEditor.AfterCommand = save
+		m.LineEditor.Highlight = baseHighlight
+	}()
+
 	for {
 		if m.csrline < len(m.lines) {
 			m.LineEditor.Default = m.lines[m.csrline]
 		} else {
 			m.LineEditor.Default = ""
 		}
-		m.after = func(string) bool { return true }
+		m.after = nil
+		newHighlight := baseHighlight
 		if len(m.Highlight) > 0 {
 			prefix := strings.Join(m.lines[:m.csrline], "\n") + "\n"
 			postfix := ""
 			if m.csrline+1 < len(m.lines) {
 				postfix = "\n" + strings.Join(m.lines[m.csrline+1:], "\n")
 			}
-			newHighlight := make([]readline.Highlight, 0, len(m.Highlight))
+			newHighlight = make([]readline.Highlight, 0, len(m.Highlight)+1)
 			for _, h := range m.Highlight {
 				newPattern := &spanPattern{
 					Original: h.Pattern,
@@ -957,18 +1363,38 @@ func (m *Editor) Read(ctx context.Context) ([]string, error) {
 				newHighlight = append(newHighlight,
 					readline.Highlight{Pattern: newPattern, Sequence: h.Sequence})
 			}
-			m.LineEditor.Highlight = newHighlight
 		}
+		m.LineEditor.DefaultColor = m.DefaultColor
+		if m.overlayActive() {
+			newHighlight = m.appendOverlayHighlight(newHighlight)
+		}
+		m.LineEditor.Highlight = newHighlight
 		line, err := m.LineEditor.ReadLine(ctx)
 		if err != nil {
+			m.clearStatusLine()
+			m.clearSuggestionRows()
 			m.PrintFromLine(m.csrline)
 			m.LineEditor.Out.WriteByte('\n')
 			m.LineEditor.Out.Flush()
 			return nil, err
 		}
 		m.LineEditor.Out.Flush()
-		if !m.after(line) {
-			return m.lines, nil
+		if m.after != nil {
+			if !m.after(line) {
+				return m.lines, nil
+			}
+			if m.undo.record(m.snapshot()) && !m.keepRegion {
+				m.markActive = false
+			}
+			m.keepRegion = false
+			if active := m.overlayActive(); active || m.overlayDrawn || m.lintUpdated {
+				m.repaintVisibleLines()
+				m.overlayDrawn = active
+				m.lintUpdated = false
+			}
+			m.requestLint()
+			m.showDiagnostic()
+			m.drawStatusLine(m.LineEditor.Cursor)
 		}
 		m.LineEditor.Out.Flush()
 	}
@@ -0,0 +1,177 @@
+package multiline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+const (
+	defaultMenuColor         = "\x1B[0;30;47m"
+	defaultMenuSelectedColor = "\x1B[0;37;44;1m"
+)
+
+func (m *Editor) menuColor() string {
+	if m.MenuColor == "" {
+		return defaultMenuColor
+	}
+	return m.MenuColor
+}
+
+func (m *Editor) menuSelectedColor() string {
+	if m.MenuSelectedColor == "" {
+		return defaultMenuSelectedColor
+	}
+	return m.MenuSelectedColor
+}
+
+// popupMenu is the state of PopupMenu.
+type popupMenu struct {
+	m        *Editor
+	items    []string
+	selected int
+	top      int  // the first item shown
+	rows     int  // the count of the rows of the menu
+	below    bool // the menu is below the cursor line
+	column   int  // the column of the screen where the menu starts
+	width    int
+}
+
+func (p *popupMenu) move(delta int) {
+	n := len(p.items)
+	p.selected = ((p.selected+delta)%n + n) % n
+	if p.selected < p.top {
+		p.top = p.selected
+	} else if p.selected >= p.top+p.rows {
+		p.top = p.selected - p.rows + 1
+	}
+}
+
+// offset returns the row of the i-th row of the menu from the cursor line.
+func (p *popupMenu) offset(i int) int {
+	if p.below {
+		return i + 1
+	}
+	return i - p.rows
+}
+
+// draw prints the menu from the cursor line and returns to it.
+func (p *popupMenu) draw(out io.Writer) {
+	current := 0
+	for i := 0; i < p.rows; i++ {
+		current = moveRows(out, current, p.offset(i))
+		fmt.Fprintf(out, "\x1B[%dG", p.column+1)
+		index := p.top + i
+		if index == p.selected {
+			io.WriteString(out, p.m.menuSelectedColor())
+		} else {
+			io.WriteString(out, p.m.menuColor())
+		}
+		io.WriteString(out, " ")
+		w := 1
+		for _, c := range readline.StringToMoji(p.items[index]) {
+			if w+int(c.Width()) >= p.width {
+				break
+			}
+			c.PrintTo(out)
+			w += int(c.Width())
+		}
+		io.WriteString(out, strings.Repeat(" ", p.width-w))
+		io.WriteString(out, resetSGR)
+	}
+	moveRows(out, current, 0)
+}
+
+// moveRows moves the cursor of the screen from the row `from` to the row `to`.
+func moveRows(out io.Writer, from, to int) int {
+	if to > from {
+		fmt.Fprintf(out, "\x1B[%dB", to-from)
+	} else if to < from {
+		fmt.Fprintf(out, "\x1B[%dA", from-to)
+	}
+	return to
+}
+
+// PopupMenu shows items in the menu below the cursor line (or above it when
+// there is no room) from the column of the start-th character of B, and
+// returns the index of the item selected with Enter. Tab, Down and Ctrl-N
+// select the next item and Shift-Tab, Up and Ctrl-P the previous one.
+// When the other key is typed, the menu is closed and it returns -1 and the key.
+// When there is no room for the menu, it returns -1 and an empty string.
+// The rows used by the menu are restored after it is closed.
+func (m *Editor) PopupMenu(B *readline.Buffer, items []string, start int) (int, string) {
+	if len(items) <= 0 {
+		return -1, ""
+	}
+	p := &popupMenu{m: m, items: items, below: true}
+	below := m.viewHeight - m.cursorRow() - 1
+	above := m.cursorRow()
+	p.rows = min(len(items), below)
+	if p.rows < len(items) && above > below {
+		p.rows = min(len(items), above)
+		p.below = false
+	}
+	if p.rows <= 0 {
+		return -1, ""
+	}
+	maxWidth := m.viewWidth - forbiddenWidth
+	for _, item := range items {
+		p.width = max(p.width, int(readline.GetStringWidth(item))+2)
+	}
+	p.width = min(p.width, maxWidth)
+	p.column = m.promptWidth(m.csrline)
+	if start > B.ViewStart {
+		p.column += int(B.GetWidthBetween(B.ViewStart, start))
+	}
+	p.column = max(min(p.column, maxWidth-p.width), 0)
+
+	out := B.Out
+	m.up(0)
+	m.clearMessage()
+	m.clearSuggestionRows()
+	visible := m.visibleRows()
+	if p.below {
+		// The rows below the lines may not exist on the screen yet.
+		io.WriteString(out, strings.Repeat("\n", p.rows))
+		m.up(p.rows)
+	}
+	defer func() {
+		m.Sync(B.String())
+		// Erase the rows below the lines, and print the lines again.
+		current := 0
+		for i := 0; i < p.rows; i++ {
+			if row := m.cursorRow() + p.offset(i); row >= visible {
+				current = moveRows(out, current, p.offset(i))
+				io.WriteString(out, "\r\x1B[K")
+			}
+		}
+		moveRows(out, current, 0)
+		m.repaintVisibleLines()
+		B.RepaintLastLine()
+		out.Flush()
+	}()
+
+	for {
+		p.draw(out)
+		moveToCursor(B)
+		io.WriteString(out, ansiCursorOn)
+		key, err := B.GetKey()
+		if err != nil {
+			return -1, ""
+		}
+		io.WriteString(out, ansiCursorOff)
+		switch key {
+		case keys.CtrlI, keys.Down, keys.CtrlN:
+			p.move(+1)
+		case keys.ShiftTab, keys.Up, keys.CtrlP:
+			p.move(-1)
+		case keys.CtrlM:
+			return p.selected, key
+		default:
+			return -1, key
+		}
+	}
+}
@@ -0,0 +1,211 @@
+package multiline
+
+import (
+	"context"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// mojiColumns returns the display columns where each Moji of s starts
+// and the width of s as the last element. A tab is expanded to the next
+// tab stop as the lines are printed.
+func (m *Editor) mojiColumns(s string) []int {
+	columns := []int{0}
+	w := 0
+	for _, c := range mojiStrings(s) {
+		if r, size := utf8.DecodeRuneInString(c); size == len(c) {
+			w += m.charWidth(r, w, 0)
+		} else {
+			w += int(readline.GetStringWidth(c))
+		}
+		columns = append(columns, w)
+	}
+	return columns
+}
+
+// displayColumn returns the display column of the col-th Moji of s.
+func (m *Editor) displayColumn(s string, col int) int {
+	columns := m.mojiColumns(s)
+	return columns[min(max(col, 0), len(columns)-1)]
+}
+
+// columnToCursor returns the position of the Moji of s
+// which is displayed at the column or the nearest left of it.
+func (m *Editor) columnToCursor(s string, column int) int {
+	columns := m.mojiColumns(s)
+	col := 0
+	for col+1 < len(columns) && columns[col+1] <= column {
+		col++
+	}
+	return col
+}
+
+// goalColumn returns the display column which vertical movement keeps.
+// It is set from the cursor when the chain of vertical movement starts.
+func (m *Editor) goalColumn(b *readline.Buffer) int {
+	if m.lastCommand != cmdVertical {
+		m.goal = m.displayColumn(b.String(), b.Cursor)
+	}
+	m.thisCommand = cmdVertical
+	return m.goal
+}
+
+// CmdBeginningOfBuffer moves the cursor to the beginning of the first line (for Meta-<)
+func (m *Editor) CmdBeginningOfBuffer(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	return m.moveCursorTo(b, position{line: 0, col: 0})
+}
+
+// CmdEndOfBuffer moves the cursor to the end of the last line (for Meta->)
+func (m *Editor) CmdEndOfBuffer(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	last := len(m.lines) - 1
+	return m.moveCursorTo(b, position{line: last, col: readline.MojiCountInString(m.lines[last])})
+}
+
+// pageLines returns the count of the lines scrolled by n screen rows
+// from the headline (backward when n < 0). It is at least one line.
+// The lines out of the buffer are counted as one row each.
+func (m *Editor) pageLines(n int) int {
+	step, first := 1, m.headline
+	if n < 0 {
+		step, first, n = -1, m.headline-1, -n
+	}
+	lines, rows := 0, 0
+	for ; lines < n; lines++ {
+		i := first + lines*step
+		r := 1
+		if i >= 0 && i < len(m.lines) {
+			r = m.rowsOfLine(i)
+		}
+		if lines > 0 && rows+r > n {
+			break
+		}
+		rows += r
+	}
+	return lines * step
+}
+
+// lastHeadline returns the headline with which the last line is at the bottom of the view.
+func (m *Editor) lastHeadline() int {
+	last, rows := len(m.lines), 0
+	for last > 0 && rows+m.rowsBetween(last-1, last) <= m.viewHeight {
+		last--
+		rows += m.rowsBetween(last, last+1)
+	}
+	return last
+}
+
+// scrollPage moves the cursor line and the headline by n screen rows.
+func (m *Editor) scrollPage(b *readline.Buffer, n int) readline.Result {
+	m.Sync(b.String())
+	d := m.pageLines(n)
+	csrline := m.csrline + d
+	if csrline < 0 {
+		csrline = 0
+	} else if csrline >= len(m.lines) {
+		csrline = len(m.lines) - 1
+	}
+	if csrline == m.csrline {
+		return readline.CONTINUE
+	}
+	goal := m.goalColumn(b)
+	m.after = func(line string) bool {
+		m.Sync(line)
+		m.relayout(func() {
+			headline := m.headline + d
+			m.csrline = csrline
+			m.headline = max(min(headline, m.lastHeadline()), 0)
+		})
+		m.LineEditor.Cursor = m.columnToCursor(m.lines[m.csrline], goal)
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdPageUp moves the cursor to the line one screen above (for PageUp)
+func (m *Editor) CmdPageUp(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.scrollPage(b, -m.viewHeight)
+}
+
+// CmdPageDown moves the cursor to the line one screen below (for PageDown)
+func (m *Editor) CmdPageDown(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.scrollPage(b, m.viewHeight)
+}
+
+func isSpaceMoji(s string) bool {
+	r, _ := utf8.DecodeRuneInString(s)
+	return unicode.IsSpace(r)
+}
+
+// forwardWordEnd returns the end of the word after pos.
+// The end of the line is treated as a white space.
+func forwardWordEnd(lines []string, pos position) position {
+	line := mojiStrings(lines[pos.line])
+	col := min(pos.col, len(line))
+	for {
+		for col < len(line) && isSpaceMoji(line[col]) {
+			col++
+		}
+		if col < len(line) || pos.line+1 >= len(lines) {
+			break
+		}
+		pos.line++
+		line = mojiStrings(lines[pos.line])
+		col = 0
+	}
+	for col < len(line) && !isSpaceMoji(line[col]) {
+		col++
+	}
+	return position{line: pos.line, col: col}
+}
+
+// backwardWordStart returns the beginning of the word before pos.
+// The end of the line is treated as a white space.
+func backwardWordStart(lines []string, pos position) position {
+	line := mojiStrings(lines[pos.line])
+	col := min(pos.col, len(line))
+	for {
+		for col > 0 && isSpaceMoji(line[col-1]) {
+			col--
+		}
+		if col > 0 || pos.line <= 0 {
+			break
+		}
+		pos.line--
+		line = mojiStrings(lines[pos.line])
+		col = len(line)
+	}
+	for col > 0 && !isSpaceMoji(line[col-1]) {
+		col--
+	}
+	return position{line: pos.line, col: col}
+}
+
+// CmdForwardWord moves the cursor to the end of the word
+// which may be on the next lines (for Meta-F and Ctrl-Right).
+// At the end of the lines, it inserts the first word of the suggestion.
+func (m *Editor) CmdForwardWord(ctx context.Context, b *readline.Buffer) readline.Result {
+	if m.suggestion != "" && m.csrline+1 >= len(m.lines) && b.Cursor >= len(b.Buffer) {
+		return m.CmdAcceptSuggestionWord(ctx, b)
+	}
+	m.Sync(b.String())
+	end := forwardWordEnd(m.lines, m.cursorPosition())
+	if end.line == m.csrline {
+		return readline.CmdForwardWord.Call(ctx, b)
+	}
+	return m.moveCursorTo(b, end)
+}
+
+// CmdBackwardWord moves the cursor to the beginning of the word
+// which may be on the previous lines (for Meta-B and Ctrl-Left)
+func (m *Editor) CmdBackwardWord(ctx context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	start := backwardWordStart(m.lines, m.cursorPosition())
+	if start.line == m.csrline {
+		return readline.CmdBackwardWord.Call(ctx, b)
+	}
+	return m.moveCursorTo(b, start)
+}
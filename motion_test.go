@@ -0,0 +1,98 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestBeginningAndEndOfBuffer(t *testing.T) {
+	keyin := strings.Split("abc\rdef\rghi", "")
+	keyin = append(keyin, keys.Escape+"<", "<", keys.Down, keys.Escape+">", ">", keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "<abc\ndef\nghi>"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestPageUpAndDown(t *testing.T) {
+	var text []string
+	for i := 0; i < 60; i++ {
+		text = append(text, "x")
+	}
+	keyin := strings.Split(strings.Join(text, "\r"), "")
+	// 24 lines per page: from line 60 to line 12, and to line 36
+	keyin = append(keyin, keys.PageUp, keys.PageUp, "U", keys.PageDown, "D", keys.CtrlJ)
+
+	var ed Editor
+	result := strings.Split(readWithKeys(t, &ed, keyin), "\n")
+	if result[11] != "xU" || result[35] != "xD" {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+}
+
+func TestPageUpAndDownWithSoftWrap(t *testing.T) {
+	var text []string
+	for i := 0; i < 30; i++ {
+		text = append(text, strings.Repeat("x", 100))
+	}
+	keyin := strings.Split(strings.Join(text, "\r"), "")
+	// The lines use 2 rows except the cursor line: 12 lines per page
+	keyin = append(keyin, keys.PageUp, "u", keys.PageDown, "d", keys.CtrlJ)
+
+	ed := Editor{SoftWrap: true}
+	result := strings.Split(readWithKeys(t, &ed, keyin), "\n")
+	if !strings.HasSuffix(result[17], "u") || !strings.HasSuffix(result[29], "d") {
+		t.Fatalf("unexpected result: %#v", result)
+	}
+}
+
+func TestWordMotionAcrossLines(t *testing.T) {
+	keyin := strings.Split("foo\r  bar baz", "")
+	// Meta-B three times moves to the top of `foo`
+	keyin = append(keyin, keys.AltB, keys.AltB, keys.AltB, "<")
+	// Meta-F twice moves to the end of `bar`
+	keyin = append(keyin, keys.AltF, keys.AltF, ">", keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "<foo\n  bar> baz"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestWordDeletionJoinsLines(t *testing.T) {
+	keyin := strings.Split("foo bar\r  baz qux", "")
+	// Meta-Backspace at the top of `baz` removes `bar` and the newline
+	keyin = append(keyin, keys.CtrlA, keys.AltF, keys.AltB, keys.AltBackspace)
+	// Meta-D at the end of line removes the newline and `quux`
+	keyin = append(keyin, keys.CtrlE, "\r", "q", "u", "u", "x", keys.Up, keys.CtrlE, keys.AltD, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "foo baz qux"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestGoalColumn(t *testing.T) {
+	keyin := strings.Split("\tabcdef\rx\rあいう\rabcdef", "")
+	// The goal column 5 is kept through the line of wide characters
+	// and the short line `x`.
+	keyin = append(keyin, keys.CtrlB, keys.Up, keys.Up, keys.Up, "!")
+	// Typing resets the goal column to 6.
+	keyin = append(keyin, keys.Down, keys.Down, "[", keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "\ta!bcdef\nx\nあいう[\nabcdef"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
@@ -0,0 +1,138 @@
+package multiline
+
+import (
+	"io"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+const resetSGR = "\x1B[0m"
+
+// overlay is the range of a line drawn with seq instead of the highlight.
+type overlay struct {
+	start int // byte offset
+	end   int
+	seq   string
+}
+
+// newOverlays returns the function which returns the overlays
+// (the region and the matching brackets) of the line i whose text is s.
+func (m *Editor) newOverlays() func(i int, s string) []overlay {
+	brackets := m.matchingBrackets()
+	return func(i int, s string) []overlay {
+		result := m.diagnosticOverlays(i, s)
+		if start, end := m.regionInLine(i, s); start < end {
+			result = append(result, overlay{start: start, end: end, seq: m.regionColor()})
+		}
+		for _, p := range brackets {
+			if p.line == i {
+				offset := mojiOffset(s, p.col)
+				result = append(result, overlay{start: offset, end: offset + 1, seq: m.MatchingBracketColor})
+			}
+		}
+		return result
+	}
+}
+
+// overlayAt returns the sequence of the overlay at the byte offset j.
+// The later overlay has priority.
+func overlayAt(overlays []overlay, j int) string {
+	seq := ""
+	for _, o := range overlays {
+		if o.start <= j && j < o.end {
+			seq = o.seq
+		}
+	}
+	return seq
+}
+
+func (m *Editor) overlayActive() bool {
+	return m.markActive || len(m.matchingBrackets()) > 0
+}
+
+type patternFunc func(string) [][]int
+
+func (f patternFunc) FindAllStringIndex(s string, _ int) [][]int {
+	return f(s)
+}
+
+// appendOverlayHighlight appends the highlight for the overlays of the cursor line.
+// Because the sequence for the overlays may not be reset by the other sequences,
+// they are prefixed with the reset sequence.
+func (m *Editor) appendOverlayHighlight(H []readline.Highlight) []readline.Highlight {
+	result := make([]readline.Highlight, 0, len(H)+1)
+	for _, h := range H {
+		result = append(result, readline.Highlight{Pattern: h.Pattern, Sequence: resetSGR + h.Sequence})
+	}
+	m.LineEditor.DefaultColor = resetSGR + m.DefaultColor
+	line := ""
+	if m.csrline < len(m.lines) {
+		line = m.lines[m.csrline]
+	}
+	overlays := m.newOverlays()
+	for _, o := range overlays(m.csrline, line) {
+		o := o
+		result = append(result, readline.Highlight{
+			Pattern: patternFunc(func(s string) [][]int {
+				if o.end > len(s) {
+					o.end = len(s)
+				}
+				if o.start >= o.end {
+					return nil
+				}
+				return [][]int{{o.start, o.end}}
+			}),
+			Sequence: o.seq,
+		})
+	}
+	return result
+}
+
+// paintOverlaysInCursorLine draws the visible part of the cursor line again
+// with the overlays. The line editor does not update the colors
+// when only the cursor moves.
+func (m *Editor) paintOverlaysInCursorLine(B *readline.Buffer) {
+	m.overlayDrawn = m.overlayActive()
+	if !m.overlayDrawn || m.csrline >= len(m.lines) {
+		return
+	}
+	line := m.lines[m.csrline]
+	var colorMap []readline.EscapeSequenceId
+	if colors := m.lineColors(); m.csrline < len(colors) {
+		colorMap = colors[m.csrline].maps
+	}
+	overlays := m.newOverlays()(m.csrline, line)
+
+	out := B.Out
+	B.GotoHead()
+	io.WriteString(out, resetSGR+m.ResetColor)
+	offset := mojiOffset(line, B.ViewStart)
+	viewWidth := B.ViewWidth()
+	width := readline.WidthT(0)
+	selected := ""
+	for i := B.ViewStart; i < len(B.Buffer); i++ {
+		c := B.Buffer[i].Moji
+		if width+c.Width() > viewWidth {
+			break
+		}
+		if seq := overlayAt(overlays, offset); seq != "" {
+			if seq != selected {
+				io.WriteString(out, resetSGR+seq)
+				selected = seq
+			}
+		} else {
+			if selected != "" {
+				io.WriteString(out, resetSGR)
+				selected = ""
+			}
+			if offset < len(colorMap) {
+				colorMap[offset].WriteTo(out)
+			}
+		}
+		c.PrintTo(out)
+		width += c.Width()
+		offset += len(B.SubString(i, i+1))
+	}
+	io.WriteString(out, resetSGR+m.ResetColor)
+	moveToCursor(B)
+}
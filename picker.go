@@ -0,0 +1,237 @@
+package multiline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"sort"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+// fuzzyScore returns how well text matches pattern whose characters appear
+// in text in the same order ignoring case. The consecutive characters and
+// the characters at the top of words get the higher score.
+// The best one of the matches starting from each position is used.
+func fuzzyScore(pattern, text string) (int, bool) {
+	pr := []rune(strings.ToLower(pattern))
+	if len(pr) <= 0 {
+		return 0, true
+	}
+	tr := []rune(strings.ToLower(text))
+	best := -1
+	for start := range tr {
+		if tr[start] != pr[0] {
+			continue
+		}
+		score := 0
+		i := 0
+		lastMatch := -2
+		for pos := start; pos < len(tr) && i < len(pr); pos++ {
+			if tr[pos] != pr[i] {
+				continue
+			}
+			score++
+			if lastMatch == pos-1 {
+				score += 2
+			}
+			if pos == 0 || (!unicode.IsLetter(tr[pos-1]) && !unicode.IsDigit(tr[pos-1])) {
+				score++
+			}
+			lastMatch = pos
+			i++
+		}
+		if i < len(pr) {
+			break
+		}
+		best = max(best, score)
+	}
+	return best, best >= 0
+}
+
+// pickerCandidate is an entry of the history listed by the picker.
+type pickerCandidate struct {
+	index  int // the index in the history
+	text   string
+	score  int
+	pinned bool
+}
+
+// historyCandidates returns the entries of the history matching query
+// in the order of the score and the newer one after the pinned ones.
+// The duplicates are removed.
+func (m *Editor) historyCandidates(query string) []pickerCandidate {
+	h := m.LineEditor.History
+	seen := map[string]struct{}{}
+	var result []pickerCandidate
+	for i := h.Len() - 1; i >= 0; i-- {
+		text := h.At(i)
+		if _, ok := seen[text]; ok || !m.acceptsHistory(i) {
+			continue
+		}
+		seen[text] = struct{}{}
+		if score, ok := fuzzyScore(query, text); ok {
+			result = append(result, pickerCandidate{index: i, text: text, score: score, pinned: m.historyPinned(i)})
+		}
+	}
+	sort.SliceStable(result, func(i, j int) bool {
+		if result[i].pinned != result[j].pinned {
+			return result[i].pinned
+		}
+		return result[i].score > result[j].score
+	})
+	return result
+}
+
+const defaultPinnedMark = "* "
+
+func (m *Editor) pinnedMark() string {
+	if m.PinnedMark == "" {
+		return defaultPinnedMark
+	}
+	return m.PinnedMark
+}
+
+// historyPicker is the state of CmdHistoryPicker.
+type historyPicker struct {
+	m          *Editor
+	query      string
+	candidates []pickerCandidate
+	selected   int
+	top        int // the first candidate in the list
+}
+
+func (p *historyPicker) move(delta, listRows int) {
+	if len(p.candidates) <= 0 {
+		return
+	}
+	p.selected = max(min(p.selected+delta, len(p.candidates)-1), 0)
+	if p.selected < p.top {
+		p.top = p.selected
+	} else if listRows > 0 && p.selected >= p.top+listRows {
+		p.top = p.selected - listRows + 1
+	}
+}
+
+// draw prints the query, the list of the candidates in listRows rows and
+// the preview of the selected one in previewRows rows below it.
+// The cursor is left after the query.
+func (p *historyPicker) draw(out io.Writer, width readline.WidthT, listRows, previewRows int) {
+	io.WriteString(out, "\r")
+	w := p.m.printRow(out, fmt.Sprintf("(history %d/%d)[%s]:", min(p.selected+1, len(p.candidates)), len(p.candidates), p.query), width, 0, 0)
+	selected := ""
+	if p.selected < len(p.candidates) {
+		selected = p.candidates[p.selected].text
+	}
+	if listRows <= 0 {
+		p.m.printRow(out, strings.ReplaceAll(selected, "\n", NewLineMarkForIncrementalSearch), width-w, 0, 0)
+		io.WriteString(out, "\x1B[K")
+		return
+	}
+	io.WriteString(out, "\x1B[K")
+	rows := 0
+	for i := p.top; i < len(p.candidates) && i < p.top+listRows; i++ {
+		io.WriteString(out, "\n")
+		text := strings.ReplaceAll(p.candidates[i].text, "\n", NewLineMarkForIncrementalSearch)
+		if p.candidates[i].pinned {
+			text = p.m.pinnedMark() + text
+		}
+		if i == p.selected {
+			io.WriteString(out, p.m.iSearchMatchColor())
+			p.m.printRow(out, text, width, 0, 0)
+			io.WriteString(out, resetSGR)
+		} else {
+			p.m.printRow(out, text, width, 0, 0)
+		}
+		io.WriteString(out, "\x1B[K")
+		rows++
+	}
+	if selected != "" {
+		for i, line := range strings.Split(selected, "\n") {
+			if i >= previewRows {
+				break
+			}
+			io.WriteString(out, "\n")
+			if i == 0 {
+				// the separator between the list and the preview
+				io.WriteString(out, "\x1B[4m")
+			}
+			p.m.printRow(out, line, width, 0, 0)
+			io.WriteString(out, resetSGR+"\x1B[K")
+			rows++
+		}
+	}
+	io.WriteString(out, "\x1B[J")
+	if rows > 0 {
+		fmt.Fprintf(out, "\x1B[%dF", rows)
+	}
+	fmt.Fprintf(out, "\x1B[%dG", w+1)
+}
+
+// CmdHistoryPicker lists the entries of the history matching the typed string
+// fuzzily below the lines and fetches the selected one (for Ctrl-X Ctrl-R).
+// Up, Down, Ctrl-P and Ctrl-N select the entry, and Enter fetches it.
+func (m *Editor) CmdHistoryPicker(_ context.Context, b *readline.Buffer) readline.Result {
+	if m.LineEditor.History == nil || m.LineEditor.History.Len() <= 0 {
+		return readline.CONTINUE
+	}
+	p := &historyPicker{m: m, candidates: m.historyCandidates("")}
+
+	available := m.previewRows()
+	listRows := min(available, max(available/2, 1))
+	previewRows := available - listRows
+
+	rewind := m.GotoEndLine()
+	defer func() {
+		io.WriteString(b.Out, "\r\x1B[J")
+		rewind()
+		b.Out.Flush()
+		b.RepaintLastLine()
+	}()
+
+	for {
+		p.draw(b.Out, b.ViewWidth(), listRows, previewRows)
+		io.WriteString(b.Out, ansiCursorOn)
+		key, err := b.GetKey()
+		if err != nil {
+			return readline.CONTINUE
+		}
+		io.WriteString(b.Out, ansiCursorOff)
+
+		switch key {
+		case keys.Up, keys.CtrlP:
+			p.move(-1, listRows)
+		case keys.Down, keys.CtrlN:
+			p.move(+1, listRows)
+		case keys.PageUp:
+			p.move(-max(listRows, 1), listRows)
+		case keys.PageDown:
+			p.move(+max(listRows, 1), listRows)
+		case "\b", "\x7F":
+			_, size := utf8.DecodeLastRuneInString(p.query)
+			p.query = p.query[:len(p.query)-size]
+			*p = historyPicker{m: m, query: p.query, candidates: m.historyCandidates(p.query)}
+		case "\r":
+			if p.selected >= len(p.candidates) {
+				return readline.CONTINUE
+			}
+			m.saveModfiedHistory(b)
+			m.historyPtr = p.candidates[p.selected].index
+			m.after = m.printCurrentHistoryRecord
+			return readline.ENTER
+		case "\x03", "\x07", "\x1B":
+			return readline.CONTINUE
+		default:
+			charcode, _ := utf8.DecodeRuneInString(key)
+			if unicode.IsControl(charcode) {
+				break
+			}
+			p.query += string(charcode)
+			*p = historyPicker{m: m, query: p.query, candidates: m.historyCandidates(p.query)}
+		}
+	}
+}
@@ -0,0 +1,86 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-readline-ny/simplehistory"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestFuzzyScore(t *testing.T) {
+	if _, ok := fuzzyScore("slt", "select"); !ok {
+		t.Fatal("slt should match select")
+	}
+	if _, ok := fuzzyScore("tls", "select"); ok {
+		t.Fatal("tls should not match select")
+	}
+	s1, _ := fuzzyScore("emp", "update emp")
+	s2, _ := fuzzyScore("emp", "e-mail ping")
+	if s1 <= s2 {
+		t.Fatalf("consecutive match should have the higher score: %d <= %d", s1, s2)
+	}
+}
+
+func TestHistoryPicker(t *testing.T) {
+	history := simplehistory.New()
+	history.Add("select *\nfrom emp")
+	history.Add("update emp\nset x=1")
+	history.Add("select 1")
+	history.Add("select 1")
+
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		{[]string{keys.CtrlX, keys.CtrlR, "\r", keys.CtrlJ}, "select 1"},
+		{[]string{keys.CtrlX, keys.CtrlR, keys.Down, "\r", keys.CtrlJ}, "update emp\nset x=1"},
+		{[]string{keys.CtrlX, keys.CtrlR, "f", "e", "\r", keys.CtrlJ}, "select *\nfrom emp"},
+		{[]string{keys.CtrlX, keys.CtrlR, "z", "\r", keys.CtrlJ}, ""},
+		// the draft is kept when coming back with Meta-N
+		{[]string{"a", keys.CtrlX, keys.CtrlR, keys.Down, keys.Down, "\r", keys.AltN, keys.AltN, keys.AltN, keys.AltN, keys.CtrlJ}, "a"},
+	} {
+		ed := Editor{}
+		ed.SetHistory(history)
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
+
+func TestHistoryPickerBelowPrompt(t *testing.T) {
+	history := simplehistory.New()
+	history.Add("select 1")
+	history.Add("select 2")
+	history.Add("select 3")
+
+	for _, p := range []struct {
+		row   string
+		shown bool
+	}{
+		{"", true},
+		{"22", false}, // only one row is listed
+	} {
+		tty := &auto.Pilot{Text: []string{keys.CtrlX, keys.CtrlR, keys.CtrlG, keys.CtrlJ}}
+		w := &reportingWriter{tty: tty, row: p.row}
+		ed := Editor{}
+		ed.SetHistory(history)
+		ed.LineEditor.Tty = tty
+		ed.SetWriter(w)
+		if _, err := ed.Read(context.Background()); err != nil {
+			t.Fatal(err.Error())
+		}
+		if shown := strings.Contains(w.out.String(), "select 1"); shown != p.shown {
+			t.Fatalf("%#v: the oldest entry is shown: %v", p.row, shown)
+		}
+	}
+}
@@ -0,0 +1,242 @@
+package multiline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// Predictor suggests the text following the lines being edited.
+// The suggestion may contain "\n" to continue to the next lines.
+type Predictor interface {
+	Predict(lines []string) string
+}
+
+// PredictorFunc is the adapter to use a function as Predictor.
+type PredictorFunc func(lines []string) string
+
+func (f PredictorFunc) Predict(lines []string) string {
+	return f(lines)
+}
+
+// PredictFromHistory returns the rest of the newest entry of the history
+// which starts with lines and is accepted by HistoryFilter.
+// (e.g.) `m.Predictor = multiline.PredictorFunc(m.PredictFromHistory)`
+func (m *Editor) PredictFromHistory(lines []string) string {
+	h := m.LineEditor.History
+	if h == nil {
+		return ""
+	}
+	text := strings.Join(lines, "\n")
+	for i := h.Len() - 1; i >= 0; i-- {
+		entry := h.At(i)
+		if len(entry) > len(text) && strings.HasPrefix(entry, text) && m.acceptsHistory(i) {
+			return entry[len(text):]
+		}
+	}
+	return ""
+}
+
+func (m *Editor) suggestionColor() string {
+	if m.SuggestionColor == "" {
+		return readline.PredictColorBlueItalic[0]
+	}
+	return m.SuggestionColor
+}
+
+// predict calls Predictor while the cursor is at the end of the last line.
+func (m *Editor) predict(B *readline.Buffer) string {
+	if m.Predictor == nil || m.csrline+1 < len(m.lines) || B.Cursor < len(B.Buffer) {
+		return ""
+	}
+	lines := append(append([]string{}, m.lines[:min(m.csrline, len(m.lines))]...), B.String())
+	if strings.TrimSpace(strings.Join(lines, "\n")) == "" {
+		return ""
+	}
+	return m.Predictor.Predict(lines)
+}
+
+// renderSuggestion is called by go-readline-ny after the cursor line is
+// printed. It prints the first line of the suggestion after the text and
+// the rest in the rows below the cursor line.
+func (m *Editor) renderSuggestion(B *readline.Buffer, availWidth int) {
+	m.suggestion = m.predict(B)
+	first, rest, multiline := strings.Cut(m.suggestion, "\n")
+	out := B.Out
+	if first != "" {
+		io.WriteString(out, m.suggestionColor())
+		for _, c := range readline.StringToMoji(first) {
+			availWidth -= int(c.Width())
+			if availWidth < 0 {
+				break
+			}
+			c.PrintTo(out)
+		}
+		io.WriteString(out, resetSGR+m.ResetColor)
+	}
+	var rows []string
+	if multiline {
+		rows = strings.Split(rest, "\n")
+	}
+	m.drawSuggestionRows(rows)
+
+	// go-readline-ny expects the cursor at the end of the text.
+	B.GotoHead()
+	if w := B.GetWidthBetween(B.ViewStart, len(B.Buffer)); w > 0 {
+		fmt.Fprintf(out, "\x1B[%dC", w)
+	}
+}
+
+// drawSuggestionRows prints rows below the cursor line as far as they do not
+// scroll the lines out of the screen, and erases the rows printed before.
+// The row for the message of showMessage is skipped.
+// The cursor of the screen must be on the last line.
+func (m *Editor) drawSuggestionRows(rows []string) {
+	top := 0
+	if m.messageDrawn {
+		top = 1
+	}
+	count := min(len(rows), max(m.viewHeight-m.visibleRows()-top, 0))
+	end := max(top+count, m.suggestionTop+m.suggestionRows)
+	if end <= 0 {
+		return
+	}
+	out := m.LineEditor.Out
+	color := m.suggestionColor()
+	for i := 0; i < end; i++ {
+		io.WriteString(out, "\n\r")
+		if i < top {
+			continue
+		}
+		if i < top+count {
+			line := len(m.lines) + i - top
+			io.WriteString(out, strings.Repeat(" ", m.promptWidth(line)))
+			io.WriteString(out, color)
+			m.printRow(out, rows[i-top], readline.WidthT(m.viewWidth-forbiddenWidth-m.promptWidth(line)), 0, 0)
+			io.WriteString(out, resetSGR+m.ResetColor)
+		}
+		io.WriteString(out, "\x1B[K")
+	}
+	m.up(end)
+	m.suggestionTop = top
+	m.suggestionRows = count
+}
+
+// clearSuggestionRows erases the rows printed by drawSuggestionRows
+// and moves the cursor to the top of the cursor line.
+func (m *Editor) clearSuggestionRows() {
+	m.suggestion = ""
+	if m.suggestionRows <= 0 {
+		return
+	}
+	out := m.LineEditor.Out
+	for i := 0; i < m.suggestionTop+m.suggestionRows; i++ {
+		io.WriteString(out, "\n\r")
+		if i >= m.suggestionTop {
+			io.WriteString(out, "\x1B[K")
+		}
+	}
+	m.up(m.suggestionTop + m.suggestionRows)
+	m.suggestionTop = 0
+	m.suggestionRows = 0
+}
+
+// eraseSuggestion erases the suggestion before the lines are changed
+// by the hook of the command, and moves the cursor back to its position.
+func (m *Editor) eraseSuggestion(B *readline.Buffer) {
+	if m.suggestion == "" && m.suggestionRows <= 0 {
+		return
+	}
+	m.clearSuggestionRows()
+	B.GotoHead()
+	if w := B.GetWidthBetween(B.ViewStart, len(B.Buffer)); w > 0 {
+		fmt.Fprintf(B.Out, "\x1B[%dC", w)
+	}
+	io.WriteString(B.Out, "\x1B[K")
+	moveToCursor(B)
+}
+
+// suggestionWord returns the first word of s with the spaces before it.
+func suggestionWord(s string) string {
+	i := 0
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if !unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	for i < len(s) {
+		r, size := utf8.DecodeRuneInString(s[i:])
+		if unicode.IsSpace(r) {
+			break
+		}
+		i += size
+	}
+	return s[:i]
+}
+
+// suggestionLine returns s until the end of the line.
+// When s starts with "\n", the next line is returned with it.
+func suggestionLine(s string) string {
+	start := 0
+	if strings.HasPrefix(s, "\n") {
+		start = 1
+	}
+	if i := strings.IndexByte(s[start:], '\n'); i >= 0 {
+		return s[:start+i]
+	}
+	return s
+}
+
+func (m *Editor) acceptSuggestion(b *readline.Buffer, text string) readline.Result {
+	if text == "" || b.Cursor < len(b.Buffer) {
+		return readline.CONTINUE
+	}
+	if !strings.Contains(text, "\n") {
+		b.InsertAndRepaint(text)
+		return readline.CONTINUE
+	}
+	m.after = func(line string) bool {
+		m.Sync(line)
+		pos := position{line: m.csrline, col: readline.MojiCountInString(m.lines[m.csrline])}
+		lines, end := insertText(m.lines, pos, text)
+		m.replaceLines(lines, end.line)
+		m.LineEditor.Cursor = end.col
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdAcceptSuggestion inserts the whole suggestion of Predictor
+// (for Right and Ctrl-F at the end of the lines)
+func (m *Editor) CmdAcceptSuggestion(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.acceptSuggestion(b, m.suggestion)
+}
+
+// CmdAcceptSuggestionWord inserts the first word of the suggestion of Predictor
+// (for Meta-F and Ctrl-Right at the end of the lines)
+func (m *Editor) CmdAcceptSuggestionWord(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.acceptSuggestion(b, suggestionWord(m.suggestion))
+}
+
+// CmdAcceptSuggestionLine inserts the suggestion of Predictor until the end
+// of the line (for Ctrl-E and End at the end of the lines)
+func (m *Editor) CmdAcceptSuggestionLine(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.acceptSuggestion(b, suggestionLine(m.suggestion))
+}
+
+// CmdEndOfLine moves the cursor to the end of the line. At the end of the
+// lines, it inserts the suggestion of Predictor until the end of the line
+// (for Ctrl-E and End)
+func (m *Editor) CmdEndOfLine(ctx context.Context, b *readline.Buffer) readline.Result {
+	if m.suggestion != "" && b.Cursor >= len(b.Buffer) {
+		return m.CmdAcceptSuggestionLine(ctx, b)
+	}
+	return readline.CmdEndOfLine.Call(ctx, b)
+}
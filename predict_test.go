@@ -0,0 +1,45 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestPredictor(t *testing.T) {
+	history := testHistory{
+		"UPDATE a\nSET x=1\nWHERE y=2",
+		"SELECT 1",
+	}
+	for _, p := range []struct {
+		keyin  []string
+		expect string
+	}{
+		{[]string{"U", "P", keys.CtrlJ}, "UP"},
+		{[]string{"U", "P", keys.Right, keys.CtrlJ}, "UPDATE a\nSET x=1\nWHERE y=2"},
+		{[]string{"U", "P", keys.AltF, keys.CtrlJ}, "UPDATE"},
+		{[]string{"U", "P", keys.AltF, keys.AltF, keys.AltF, keys.CtrlJ}, "UPDATE a\nSET"},
+		{[]string{"U", "P", keys.CtrlE, keys.CtrlJ}, "UPDATE a"},
+		{[]string{"U", "P", keys.CtrlE, keys.CtrlE, keys.CtrlJ}, "UPDATE a\nSET x=1"},
+		{[]string{"U", "P", keys.Left, keys.Right, keys.CtrlJ}, "UP"},
+		{[]string{"U", "P", keys.Left, keys.CtrlE, "!", keys.CtrlJ}, "UP!"},
+		{[]string{"S", keys.CtrlM, keys.Right, keys.CtrlJ}, "S\n"},
+	} {
+		ed := &Editor{}
+		ed.SetHistory(history)
+		ed.Predictor = PredictorFunc(ed.PredictFromHistory)
+		ed.LineEditor.Tty = &auto.Pilot{Text: p.keyin}
+		ed.SetWriter(io.Discard)
+		lines, err := ed.Read(context.Background())
+		if err != nil {
+			t.Fatal(err.Error())
+		}
+		if result := strings.Join(lines, "\n"); result != p.expect {
+			t.Fatalf("%#v: expect %#v, but %#v", p.keyin, p.expect, result)
+		}
+	}
+}
@@ -0,0 +1,217 @@
+package multiline
+
+import (
+	"context"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+const (
+	keyShiftUp    = "\x1B[1;2A"
+	keyShiftDown  = "\x1B[1;2B"
+	keyShiftRight = "\x1B[1;2C"
+	keyShiftLeft  = "\x1B[1;2D"
+	keyCtrlSpace  = "\x00"
+)
+
+// position is the location in all lines. col is the count of Moji.
+type position struct {
+	line int
+	col  int
+}
+
+func (p position) less(q position) bool {
+	return p.line < q.line || (p.line == q.line && p.col < q.col)
+}
+
+// mojiOffset returns the byte offset of the n-th Moji in s.
+func mojiOffset(s string, n int) int {
+	offset := 0
+	for _, m := range readline.StringToMoji(s) {
+		if n <= 0 {
+			break
+		}
+		var buffer strings.Builder
+		m.WriteTo(&buffer)
+		offset += buffer.Len()
+		n--
+	}
+	return offset
+}
+
+func (m *Editor) regionColor() string {
+	if m.RegionColor == "" {
+		return "\x1B[7m"
+	}
+	return m.RegionColor
+}
+
+func (m *Editor) cursorPosition() position {
+	col := m.LineEditor.Cursor
+	if m.csrline < len(m.lines) {
+		if n := readline.MojiCountInString(m.lines[m.csrline]); col > n {
+			col = n
+		}
+	}
+	return position{line: m.csrline, col: col}
+}
+
+// region returns the start and the end of the selected region.
+func (m *Editor) region() (start, end position, ok bool) {
+	if !m.markActive {
+		return
+	}
+	start = m.mark
+	end = m.cursorPosition()
+	if end.less(start) {
+		start, end = end, start
+	}
+	return start, end, true
+}
+
+// regionInLine returns the byte offsets of the region in the line i whose text is s.
+// When the region continues to the next line, end is len(s)+1.
+func (m *Editor) regionInLine(i int, s string) (start, end int) {
+	rs, re, ok := m.region()
+	if !ok || i < rs.line || i > re.line || rs == re {
+		return 0, 0
+	}
+	if i == rs.line {
+		start = mojiOffset(s, rs.col)
+	}
+	if i == re.line {
+		end = mojiOffset(s, re.col)
+	} else {
+		end = len(s) + 1
+	}
+	return
+}
+
+// regionText returns the text in the region joined with "\n".
+func regionText(lines []string, start, end position) string {
+	if start.line == end.line {
+		s := lines[start.line]
+		return s[mojiOffset(s, start.col):mojiOffset(s, end.col)]
+	}
+	var buffer strings.Builder
+	s := lines[start.line]
+	buffer.WriteString(s[mojiOffset(s, start.col):])
+	for _, s := range lines[start.line+1 : end.line] {
+		buffer.WriteByte('\n')
+		buffer.WriteString(s)
+	}
+	buffer.WriteByte('\n')
+	s = lines[end.line]
+	buffer.WriteString(s[:mojiOffset(s, end.col)])
+	return buffer.String()
+}
+
+// deleteRegion returns the new lines from which the region is removed.
+func deleteRegion(lines []string, start, end position) []string {
+	head := lines[start.line]
+	tail := lines[end.line]
+	joined := head[:mojiOffset(head, start.col)] + tail[mojiOffset(tail, end.col):]
+
+	result := make([]string, 0, len(lines)-(end.line-start.line))
+	result = append(result, lines[:start.line]...)
+	result = append(result, joined)
+	result = append(result, lines[end.line+1:]...)
+	return result
+}
+
+// updateShiftSelection deactivates the region selected by Shift+arrow keys
+// when the other command is called.
+func (m *Editor) updateShiftSelection() {
+	if m.markShifted && !m.shiftMoved {
+		m.markActive = false
+		m.markShifted = false
+	}
+	m.shiftMoved = false
+}
+
+// CmdSetMark sets the mark at the cursor position and activates the region (for Ctrl-Space or Ctrl-@)
+func (m *Editor) CmdSetMark(_ context.Context, b *readline.Buffer) readline.Result {
+	m.mark = position{line: m.csrline, col: b.Cursor}
+	m.markActive = true
+	m.markShifted = false
+	return readline.CONTINUE
+}
+
+// CmdDeactivateMark deactivates the region (for Ctrl-G)
+func (m *Editor) CmdDeactivateMark(_ context.Context, _ *readline.Buffer) readline.Result {
+	m.markActive = false
+	m.markShifted = false
+	return readline.CONTINUE
+}
+
+// CmdKillRegion removes the text in the region and saves it into the kill ring (for Ctrl-W).
+// When the region is not active, it removes the word before the cursor.
+func (m *Editor) CmdKillRegion(ctx context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	start, end, ok := m.region()
+	if !ok {
+		return m.CmdUnixWordRubout(ctx, b)
+	}
+	m.markActive = false
+	m.markShifted = false
+	if start.line == end.line {
+		m.kill(regionText(m.lines, start, end), false)
+		b.Delete(start.col, end.col-start.col)
+		b.Cursor = start.col
+		b.RepaintAfterPrompt()
+		return readline.CONTINUE
+	}
+	return m.killBetween(start, end, false)
+}
+
+// CmdCopyRegion saves the text in the region into the kill ring and deactivates the region (for Meta-W)
+func (m *Editor) CmdCopyRegion(_ context.Context, b *readline.Buffer) readline.Result {
+	m.Sync(b.String())
+	start, end, ok := m.region()
+	if !ok {
+		return readline.CONTINUE
+	}
+	m.markActive = false
+	m.markShifted = false
+	m.kill(regionText(m.lines, start, end), false)
+	return readline.CONTINUE
+}
+
+func (m *Editor) shiftSelect(f readline.AnonymousCommand) readline.AnonymousCommand {
+	return func(ctx context.Context, b *readline.Buffer) readline.Result {
+		if !m.markActive {
+			m.mark = position{line: m.csrline, col: b.Cursor}
+			m.markActive = true
+			m.markShifted = true
+		}
+		m.shiftMoved = true
+		return f(ctx, b)
+	}
+}
+
+// CmdSelectBackwardChar extends the region to the previous character (for Shift+Left)
+func (m *Editor) CmdSelectBackwardChar(ctx context.Context, b *readline.Buffer) readline.Result {
+	return m.shiftSelect(m.CmdBackwardChar)(ctx, b)
+}
+
+// CmdSelectForwardChar extends the region to the next character (for Shift+Right)
+func (m *Editor) CmdSelectForwardChar(ctx context.Context, b *readline.Buffer) readline.Result {
+	return m.shiftSelect(m.CmdForwardChar)(ctx, b)
+}
+
+// CmdSelectPreviousLine extends the region to the previous line (for Shift+Up)
+func (m *Editor) CmdSelectPreviousLine(ctx context.Context, b *readline.Buffer) readline.Result {
+	if m.csrline <= 0 {
+		return readline.CONTINUE
+	}
+	return m.shiftSelect(m.CmdPreviousLine)(ctx, b)
+}
+
+// CmdSelectNextLine extends the region to the next line (for Shift+Down)
+func (m *Editor) CmdSelectNextLine(ctx context.Context, b *readline.Buffer) readline.Result {
+	if m.csrline >= len(m.lines)-1 {
+		return readline.CONTINUE
+	}
+	return m.shiftSelect(m.CmdNextLine)(ctx, b)
+}
@@ -0,0 +1,48 @@
+package multiline
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestKillRegionAcrossLines(t *testing.T) {
+	keyin := strings.Split("abc\rdef", "")
+	// Select from `b` to `e` and kill
+	keyin = append(keyin, keys.CtrlA, keys.Up, keys.CtrlF, keyCtrlSpace, keys.Down, keys.CtrlF, keys.CtrlW)
+	keyin = append(keyin, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "af"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestCopyRegionAndYank(t *testing.T) {
+	keyin := strings.Split("abc\rdef", "")
+	// Select `c` to `d` with Shift+arrows, copy and paste at the end
+	keyin = append(keyin, keys.CtrlA, keys.Up, keys.CtrlF, keys.CtrlF, keyShiftDown, keyShiftLeft)
+	keyin = append(keyin, keys.Escape+"w", keys.CtrlE, keys.CtrlY, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "abc\ndefc\nd"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestRegionText(t *testing.T) {
+	lines := []string{"SELECT *", "  FROM", "DUAL"}
+	start := position{line: 0, col: 7}
+	end := position{line: 2, col: 2}
+	if got := regionText(lines, start, end); got != "*\n  FROM\nDU" {
+		t.Fatalf("regionText: %#v", got)
+	}
+	if got := strings.Join(deleteRegion(lines, start, end), "\n"); got != "SELECT AL" {
+		t.Fatalf("deleteRegion: %#v", got)
+	}
+}
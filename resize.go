@@ -0,0 +1,160 @@
+package multiline
+
+import (
+	"bufio"
+	"io"
+	"regexp"
+	"strconv"
+	"time"
+
+	"github.com/nyaosorg/go-ttyadapter"
+)
+
+// resizeTty passes the change of the terminal size detected by
+// the Tty of go-readline-ny to Editor.
+//
+// Editor.mutex is locked while Editor.Read is running except while
+// waiting for a key between commands, so the lines are repainted only
+// between commands. While a command reads keys by itself (e.g. the prefix
+// commands, the incremental search and the menus), the mutex is kept locked
+// and the resize waits for the command to finish.
+//
+// It also asks the terminal where the cursor is (see cursorRow).
+type resizeTty struct {
+	ttyadapter.Tty
+	m          *Editor
+	pending    []keyResult    // the keys read while waiting for the report of the cursor
+	reading    chan keyResult // not nil while a key is read in another goroutine
+	unanswered int            // the count of the reports which may arrive later
+}
+
+type keyResult struct {
+	key string
+	err error
+}
+
+func (t *resizeTty) Open(onResize func(int, int)) error {
+	if onResize == nil {
+		return t.Tty.Open(nil)
+	}
+	t.m.repaintCursorLine = func() {
+		onResize(t.m.viewWidth, t.m.viewHeight+t.m.StatusLineHeight)
+	}
+	return t.Tty.Open(func(w, h int) {
+		t.m.resize(w, h)
+		// go-readline-ny repaints the cursor line
+		onResize(w, h)
+	})
+}
+
+func (t *resizeTty) Close() error {
+	t.m.repaintCursorLine = nil
+	return t.Tty.Close()
+}
+
+func (t *resizeTty) GetKey() (string, error) {
+	if t.m.commandRunning {
+		return t.readKey()
+	}
+	t.m.mutex.Unlock()
+	defer func() {
+		t.m.mutex.Lock()
+		t.m.commandRunning = true
+	}()
+	return t.readKey()
+}
+
+// cursorReport is the answer of the terminal to `ESC[6n`.
+var cursorReport = regexp.MustCompile(`^\x1B\[(\d+);(\d+)R$`)
+
+// cursorReportTimeout is how long cursorRow waits for the answer.
+const cursorReportTimeout = 200 * time.Millisecond
+
+func (t *resizeTty) readKey() (string, error) {
+	for {
+		var r keyResult
+		if len(t.pending) > 0 {
+			r, t.pending = t.pending[0], t.pending[1:]
+		} else if t.reading != nil {
+			r = <-t.reading
+			t.reading = nil
+		} else {
+			r.key, r.err = t.Tty.GetKey()
+		}
+		// The report arriving after cursorRow gave up is not a key.
+		// (Shift-F3 of xterm looks like it too.)
+		if r.err != nil || t.unanswered <= 0 || !cursorReport.MatchString(r.key) {
+			return r.key, r.err
+		}
+		t.unanswered--
+	}
+}
+
+// cursorRow returns the row of the screen (from 1) where the cursor is,
+// asking the terminal with `ESC[6n`. When the terminal does not answer
+// before a key is typed or cursorReportTimeout, it returns false.
+// The keys read meanwhile are returned by GetKey later. While the answer
+// to the last question has not arrived, it does not ask again.
+func (t *resizeTty) cursorRow(out *bufio.Writer) (int, bool) {
+	if t.unanswered > 0 {
+		return 0, false
+	}
+	io.WriteString(out, "\x1B[6n")
+	out.Flush()
+	if t.reading == nil {
+		reading := make(chan keyResult, 1)
+		t.reading = reading
+		go func() {
+			key, err := t.Tty.GetKey()
+			reading <- keyResult{key: key, err: err}
+		}()
+	}
+	select {
+	case r := <-t.reading:
+		t.reading = nil
+		if r.err == nil {
+			if match := cursorReport.FindStringSubmatch(r.key); match != nil {
+				row, _ := strconv.Atoi(match[1])
+				return row, true
+			}
+		}
+		t.pending = append(t.pending, r)
+	case <-time.After(cursorReportTimeout):
+	}
+	t.unanswered++
+	return 0, false
+}
+
+// resize updates the size of the view and prints the visible lines again.
+func (m *Editor) resize(w, h int) {
+	m.mutex.Lock()
+	defer m.mutex.Unlock()
+
+	if m.repaintCursorLine == nil {
+		// Read has returned while waiting for the command to finish.
+		m.setViewSize(w, h)
+		return
+	}
+	m.up(m.cursorRow())
+	io.WriteString(m.LineEditor.Out, "\x1B[J")
+	m.messageDrawn = false
+	m.suggestionRows = 0
+	m.setViewSize(w, h)
+	m.adjustHeadline()
+	lfCount := m.PrintFromLine(m.headline)
+	m.up(lfCount - m.cursorRow())
+	m.showDiagnostic()
+	m.drawStatusLine(m.statusCursor)
+	if m.OnResize != nil {
+		m.OnResize(w, h)
+	}
+	m.LineEditor.Out.Flush()
+}
+
+func (m *Editor) setViewSize(w, h int) {
+	m.viewWidth = w
+	m.viewHeight = h - m.StatusLineHeight
+	if m.viewHeight < 1 {
+		m.viewHeight = 1
+	}
+}
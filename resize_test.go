@@ -0,0 +1,101 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+// resizingPilot is auto.Pilot which keeps the callback for resizing.
+type resizingPilot struct {
+	auto.Pilot
+	onResize func(int, int)
+}
+
+func (p *resizingPilot) Open(onResize func(int, int)) error {
+	p.onResize = onResize
+	return p.Pilot.Open(onResize)
+}
+
+func TestResize(t *testing.T) {
+	keyin := strings.Split("abc\rdef", "")
+	keyin = append(keyin, keys.Up, "x", keys.CtrlJ)
+
+	tty := &resizingPilot{}
+	tty.Text = keyin
+	tty.OnGetKey = func(p *auto.Pilot) error {
+		if len(p.Text) == 2 && p.Width != 40 {
+			p.Width = 40
+			p.Height = 10
+			tty.onResize(p.Width, p.Height)
+		}
+		return nil
+	}
+	var width, height int
+	ed := Editor{StatusLineHeight: 1}
+	ed.OnResize = func(w, h int) {
+		width, height = w, h
+	}
+	ed.LineEditor.Tty = tty
+	ed.SetWriter(io.Discard)
+	lines, err := ed.Read(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result := strings.Join(lines, "\n"); result != "abcx\ndef" {
+		t.Fatalf("expect %#v, but %#v", "abcx\ndef", result)
+	}
+	if width != 40 || height != 10 {
+		t.Fatalf("OnResize is called with (%d,%d)", width, height)
+	}
+	if ed.viewWidth != 40 || ed.viewHeight != 9 {
+		t.Fatalf("expect the view 40x9, but %dx%d", ed.viewWidth, ed.viewHeight)
+	}
+}
+
+func TestResizeWaitsForCommand(t *testing.T) {
+	// Ctrl-X reads the next key by itself.
+	keyin := []string{"a", keys.CtrlX, "d", keys.CtrlJ}
+
+	tty := &resizingPilot{}
+	tty.Text = keyin
+	resized := make(chan struct{})
+	done := make(chan struct{})
+	tty.OnGetKey = func(p *auto.Pilot) error {
+		if len(p.Text) == 2 && p.Width != 40 {
+			p.Width = 40
+			p.Height = 10
+			onResize := tty.onResize
+			go func() {
+				onResize(40, 10)
+				close(done)
+			}()
+			select {
+			case <-resized:
+				t.Error("the lines are repainted while Ctrl-X reads a key")
+			case <-time.After(50 * time.Millisecond):
+			}
+		}
+		return nil
+	}
+	var ed Editor
+	ed.OnResize = func(int, int) { close(resized) }
+	ed.LineEditor.Tty = tty
+	ed.SetWriter(io.Discard)
+	lines, err := ed.Read(context.Background())
+	<-done
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result := strings.Join(lines, "\n"); result != "a\na" {
+		t.Fatalf("expect %#v, but %#v", "a\na", result)
+	}
+	if ed.viewWidth != 40 || ed.viewHeight != 10 {
+		t.Fatalf("expect the view 40x10, but %dx%d", ed.viewWidth, ed.viewHeight)
+	}
+}
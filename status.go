@@ -0,0 +1,115 @@
+package multiline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// Status is the information given to Editor.StatusLine.
+type Status struct {
+	Mode      string // "MARK" while the region is active, otherwise ""
+	Line      int    // the line number of the cursor starting from 1
+	Column    int    // the column (the count of characters) of the cursor starting from 1
+	LineCount int
+	Dirty     bool
+	Message   string // the message set by SetStatusMessage
+	Width     int    // the width of the terminal
+}
+
+// SetStatusMessage sets the message shown in the status lines
+// until the next command is executed.
+func (m *Editor) SetStatusMessage(message string) {
+	m.statusMessage = message
+	m.statusMessageFresh = true
+}
+
+// expireStatusMessage clears the message which has been shown since the previous command.
+func (m *Editor) expireStatusMessage() {
+	if !m.statusMessageFresh {
+		m.statusMessage = ""
+	}
+	m.statusMessageFresh = false
+}
+
+func (m *Editor) status(cursor int) Status {
+	st := Status{
+		Line:      m.csrline + 1,
+		LineCount: max(len(m.lines), m.csrline+1),
+		Dirty:     m.Dirty,
+		Message:   m.statusMessage,
+		Width:     m.viewWidth,
+	}
+	if m.csrline < len(m.lines) {
+		cursor = min(cursor, readline.MojiCountInString(m.lines[m.csrline]))
+	}
+	st.Column = cursor + 1
+	if m.markActive {
+		st.Mode = "MARK"
+	}
+	if st.Message == "" {
+		st.Message = m.cursorLineDiagnostic()
+	}
+	return st
+}
+
+// drawStatusLine prints the status lines below the last visible line
+// and moves the cursor back to the top of the cursor line.
+func (m *Editor) drawStatusLine(cursor int) {
+	if m.StatusLine == nil || m.StatusLineHeight <= 0 {
+		return
+	}
+	m.statusCursor = cursor
+	var buffer strings.Builder
+	m.StatusLine(&buffer, m.status(cursor))
+	rows := strings.Split(strings.TrimRight(buffer.String(), "\n"), "\n")
+
+	out := m.LineEditor.Out
+	lfCount := m.visibleRows() - m.cursorRow()
+	io.WriteString(out, "\r"+strings.Repeat("\n", lfCount))
+	for i := 0; i < m.StatusLineHeight; i++ {
+		if i > 0 {
+			out.WriteByte('\n')
+			lfCount++
+		}
+		if i < len(rows) {
+			io.WriteString(out, rows[i])
+		}
+		io.WriteString(out, m.ResetColor+"\x1B[K")
+	}
+	// erase the status lines drawn lower before
+	io.WriteString(out, "\x1B[J")
+	m.up(lfCount)
+	out.Flush()
+}
+
+// clearStatusLine erases the status lines.
+func (m *Editor) clearStatusLine() {
+	if m.StatusLine == nil || m.StatusLineHeight <= 0 {
+		return
+	}
+	lfCount := m.visibleRows() - m.cursorRow()
+	fmt.Fprintf(m.LineEditor.Out, "\x1B[%dE\x1B[J", lfCount)
+	m.up(lfCount)
+}
+
+// drawStatusLineInEditing prints the status lines while go-readline-ny
+// is editing the cursor line, and moves the cursor back to its position.
+func (m *Editor) drawStatusLineInEditing(B *readline.Buffer) {
+	if m.StatusLine == nil || m.StatusLineHeight <= 0 {
+		return
+	}
+	m.drawStatusLine(B.Cursor)
+	moveToCursor(B)
+}
+
+// moveToCursor moves the cursor of the screen in the cursor line
+// to the position of the cursor of B.
+func moveToCursor(B *readline.Buffer) {
+	B.GotoHead()
+	if w := B.GetWidthBetween(B.ViewStart, B.Cursor); w > 0 {
+		fmt.Fprintf(B.Out, "\x1B[%dC", w)
+	}
+}
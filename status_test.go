@@ -0,0 +1,45 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny"
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestStatusLine(t *testing.T) {
+	keyin := strings.Split("abc\rde", "")
+	keyin = append(keyin, keyCtrlSpace, keys.Up, keys.CtrlT, keys.CtrlJ)
+
+	tty := &auto.Pilot{Text: keyin}
+	var statuses []Status
+	ed := Editor{StatusLineHeight: 1}
+	ed.StatusLine = func(w io.Writer, status Status) {
+		statuses = append(statuses, status)
+	}
+	ed.LineEditor.Tty = tty
+	ed.SetWriter(io.Discard)
+	ed.BindKey(keys.CtrlT, readline.AnonymousCommand(func(context.Context, *readline.Buffer) readline.Result {
+		ed.SetStatusMessage("hello")
+		return readline.CONTINUE
+	}))
+	if _, err := ed.Read(context.Background()); err != nil {
+		t.Fatal(err.Error())
+	}
+	// the initial status and the status after each command but the submit
+	if len(statuses) != len(keyin) {
+		t.Fatalf("StatusLine is called %d times", len(statuses))
+	}
+	expect := Status{Mode: "MARK", Line: 1, Column: 3, LineCount: 2, Dirty: true, Width: 80}
+	if st := statuses[len(statuses)-2]; st != expect {
+		t.Fatalf("expect %#v, but %#v", expect, st)
+	}
+	expect.Message = "hello"
+	if st := statuses[len(statuses)-1]; st != expect {
+		t.Fatalf("expect %#v, but %#v", expect, st)
+	}
+}
@@ -0,0 +1,229 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// undoState is a snapshot of all lines and the cursor position.
+type undoState struct {
+	lines   []string
+	csrline int
+	cursor  int
+}
+
+type undoKind int
+
+const (
+	undoOther undoKind = iota
+	undoInsert
+	undoDelete
+)
+
+// undoJournal is the undo/redo stack for all lines owned by Editor.
+// Successive insertions (or deletions) at the same place of the same line
+// are grouped into one unit. A unit of insertions is closed by a white space.
+type undoJournal struct {
+	present undoState
+	undoes  []undoState
+	redoes  []undoState
+	kind    undoKind
+	line    int
+	pos     int // the position where the last grouped edit ended
+}
+
+func (j *undoJournal) reset(s undoState) {
+	j.present = s
+	j.undoes = j.undoes[:0]
+	j.redoes = j.redoes[:0]
+	j.kind = undoOther
+}
+
+func equalLines(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+func mojiStrings(s string) []string {
+	result := []string{}
+	for _, m := range readline.StringToMoji(s) {
+		var buffer strings.Builder
+		m.WriteTo(&buffer)
+		result = append(result, buffer.String())
+	}
+	return result
+}
+
+// commonEnds returns the length of the common prefix and suffix of o and n.
+func commonEnds(o, n []string) (prefix, suffix int) {
+	for prefix < len(o) && prefix < len(n) && o[prefix] == n[prefix] {
+		prefix++
+	}
+	for suffix < len(o)-prefix && suffix < len(n)-prefix &&
+		o[len(o)-1-suffix] == n[len(n)-1-suffix] {
+		suffix++
+	}
+	return
+}
+
+// classify returns the kind of the change from the present state to s
+// and the positions where the change starts and ends.
+func (j *undoJournal) classify(s undoState) (kind undoKind, start, end int) {
+	old := j.present
+	if len(old.lines) != len(s.lines) || old.csrline != s.csrline {
+		return undoOther, 0, 0
+	}
+	changed := -1
+	for i := range s.lines {
+		if old.lines[i] != s.lines[i] {
+			if changed >= 0 {
+				return undoOther, 0, 0
+			}
+			changed = i
+		}
+	}
+	if changed != s.csrline {
+		return undoOther, 0, 0
+	}
+	o := mojiStrings(old.lines[changed])
+	n := mojiStrings(s.lines[changed])
+	prefix, suffix := commonEnds(o, n)
+	if len(o)-prefix-suffix == 0 {
+		return undoInsert, prefix, len(n) - suffix
+	}
+	if len(n)-prefix-suffix == 0 {
+		return undoDelete, prefix, len(o) - suffix
+	}
+	return undoOther, 0, 0
+}
+
+// record compares s with the present state and pushes the present state
+// to the undo stack when the text has changed. It returns true in that case.
+func (j *undoJournal) record(s undoState) bool {
+	if equalLines(j.present.lines, s.lines) {
+		if j.present.csrline != s.csrline || j.present.cursor != s.cursor {
+			j.present.csrline = s.csrline
+			j.present.cursor = s.cursor
+			j.kind = undoOther
+		}
+		return false
+	}
+	kind, start, end := j.classify(s)
+	merge := false
+	switch kind {
+	case undoInsert:
+		r, _ := utf8.DecodeRuneInString(strings.Join(mojiStrings(s.lines[s.csrline])[start:end], ""))
+		merge = j.kind == undoInsert && j.line == s.csrline && j.pos == start && !unicode.IsSpace(r)
+		j.pos = end
+	case undoDelete:
+		merge = j.kind == undoDelete && j.line == s.csrline && (j.pos == end || j.pos == start)
+		j.pos = start
+	}
+	if !merge {
+		j.undoes = append(j.undoes, j.present)
+	}
+	j.kind = kind
+	j.line = s.csrline
+	j.redoes = j.redoes[:0]
+	j.present = s
+	return true
+}
+
+func (j *undoJournal) undo() (undoState, bool) {
+	if len(j.undoes) <= 0 {
+		return undoState{}, false
+	}
+	j.redoes = append(j.redoes, j.present)
+	j.present = j.undoes[len(j.undoes)-1]
+	j.undoes = j.undoes[:len(j.undoes)-1]
+	j.kind = undoOther
+	return j.present, true
+}
+
+func (j *undoJournal) redo() (undoState, bool) {
+	if len(j.redoes) <= 0 {
+		return undoState{}, false
+	}
+	j.undoes = append(j.undoes, j.present)
+	j.present = j.redoes[len(j.redoes)-1]
+	j.redoes = j.redoes[:len(j.redoes)-1]
+	j.kind = undoOther
+	return j.present, true
+}
+
+// snapshotWith returns the current state whose cursor line is replaced with line.
+func (m *Editor) snapshotWith(line string) undoState {
+	lines := make([]string, len(m.lines), len(m.lines)+1)
+	copy(lines, m.lines)
+	if m.csrline >= len(lines) {
+		lines = append(lines, line)
+	} else {
+		lines[m.csrline] = line
+	}
+	cursor := m.LineEditor.Cursor
+	if n := readline.MojiCountInString(line); cursor > n {
+		cursor = n
+	}
+	return undoState{lines: lines, csrline: m.csrline, cursor: cursor}
+}
+
+// snapshot returns the current state of m.lines.
+func (m *Editor) snapshot() undoState {
+	if m.csrline < len(m.lines) {
+		return m.snapshotWith(m.lines[m.csrline])
+	}
+	return m.snapshotWith("")
+}
+
+// replaceLines erases the lines on the screen and prints the new lines.
+// The cursor of the screen must be on the line `m.csrline`.
+func (m *Editor) replaceLines(lines []string, csrline int) {
+	m.relayout(func() {
+		m.lines = lines
+		m.csrline = csrline
+		m.Dirty = true
+	})
+}
+
+func (m *Editor) restoreState(s undoState) {
+	lines := make([]string, len(s.lines))
+	copy(lines, s.lines)
+	m.replaceLines(lines, s.csrline)
+	m.LineEditor.Cursor = s.cursor
+}
+
+func (m *Editor) callUndoOrRedo(b *readline.Buffer, f func() (undoState, bool)) readline.Result {
+	m.undo.record(m.snapshotWith(b.String()))
+	s, ok := f()
+	if !ok {
+		io.WriteString(b.Out, "\a")
+		return readline.CONTINUE
+	}
+	m.after = func(string) bool {
+		m.restoreState(s)
+		return true
+	}
+	return readline.ENTER
+}
+
+// CmdUndo cancels the last change of all lines (for Ctrl-_ , Ctrl-Z and Ctrl-X u)
+func (m *Editor) CmdUndo(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.callUndoOrRedo(b, m.undo.undo)
+}
+
+// CmdRedo restores the change cancelled by CmdUndo (for Meta-_)
+func (m *Editor) CmdRedo(_ context.Context, b *readline.Buffer) readline.Result {
+	return m.callUndoOrRedo(b, m.undo.redo)
+}
@@ -0,0 +1,62 @@
+package multiline
+
+import (
+	"context"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func readWithKeys(t *testing.T, ed *Editor, keyin []string) string {
+	t.Helper()
+	ed.LineEditor.Tty = &auto.Pilot{Text: keyin}
+	ed.SetWriter(io.Discard)
+	lines, err := ed.Read(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	return strings.Join(lines, "\n")
+}
+
+func TestUndoJoinedLines(t *testing.T) {
+	keyin := strings.Split("abc\rdef", "")
+	// Join lines with Backspace at the beginning of the second line
+	keyin = append(keyin, keys.CtrlA, keys.Backspace)
+	// Undo the join
+	keyin = append(keyin, keys.CtrlUnderbar, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "abc\ndef"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestUndoGroupsWords(t *testing.T) {
+	keyin := strings.Split("hello world", "")
+	keyin = append(keyin, keys.CtrlUnderbar, keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "hello"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
+
+func TestRedo(t *testing.T) {
+	keyin := strings.Split("abc\rdef", "")
+	keyin = append(keyin, keys.CtrlA, keys.Backspace)
+	keyin = append(keyin, keys.CtrlUnderbar, keys.Escape+"_", keys.CtrlJ)
+
+	var ed Editor
+	result := readWithKeys(t, &ed, keyin)
+	expect := "abcdef"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}
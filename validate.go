@@ -0,0 +1,91 @@
+package multiline
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/nyaosorg/go-readline-ny"
+)
+
+// ValidationError is the error returned by Editor.Validate
+// to tell where the lines are invalid.
+type ValidationError struct {
+	Line    int // the index of the line starting from 0
+	Column  int // the count of characters before the position in the line
+	Message string
+}
+
+func (e *ValidationError) Error() string {
+	return e.Message
+}
+
+// validate calls m.Validate. When it fails, validate moves the cursor to
+// the position told by the error, shows the message and returns false.
+// The cursor of the screen must be on the line `m.csrline`.
+func (m *Editor) validate() bool {
+	if m.Validate == nil {
+		return true
+	}
+	err := m.Validate(m.lines)
+	if err == nil {
+		return true
+	}
+	var verr *ValidationError
+	if errors.As(err, &verr) && len(m.lines) > 0 {
+		line := max(min(verr.Line, len(m.lines)-1), 0)
+		if line != m.csrline {
+			m.moveCursorLine(line)
+		}
+		m.LineEditor.Cursor = max(min(verr.Column, readline.MojiCountInString(m.lines[line])), 0)
+	}
+	m.showMessage(err.Error())
+	return false
+}
+
+// showMessage shows msg until the next command is executed.
+// With StatusLine, msg is given as Status.Message. Otherwise, it is printed
+// in the row below the last visible line.
+// The cursor of the screen must be at the top of the line `m.csrline`.
+func (m *Editor) showMessage(msg string) {
+	if m.StatusLine != nil && m.StatusLineHeight > 0 {
+		m.SetStatusMessage(msg)
+		return
+	}
+	out := m.LineEditor.Out
+	lfCount := m.visibleRows() - m.cursorRow()
+	io.WriteString(out, "\r"+strings.Repeat("\n", lfCount))
+	width := readline.WidthT(0)
+	for _, c := range readline.StringToMoji(strings.ReplaceAll(msg, "\n", " ")) {
+		if width+c.Width() >= readline.WidthT(m.viewWidth) {
+			break
+		}
+		c.PrintTo(out)
+		width += c.Width()
+	}
+	io.WriteString(out, "\x1B[K")
+	m.up(lfCount)
+	m.messageDrawn = true
+}
+
+// clearMessage erases the message printed by showMessage
+// and moves the cursor to the top of the cursor line.
+func (m *Editor) clearMessage() {
+	if !m.messageDrawn {
+		return
+	}
+	m.messageDrawn = false
+	lfCount := m.visibleRows() - m.cursorRow()
+	fmt.Fprintf(m.LineEditor.Out, "\x1B[%dE\x1B[K", lfCount)
+	m.up(lfCount)
+}
+
+// eraseMessage erases the message printed by showMessage
+// and moves the cursor back to its position in the cursor line.
+func (m *Editor) eraseMessage(B *readline.Buffer) {
+	if m.messageDrawn {
+		m.clearMessage()
+		moveToCursor(B)
+	}
+}
@@ -0,0 +1,42 @@
+package multiline
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+	"github.com/nyaosorg/go-ttyadapter/auto"
+)
+
+func TestValidate(t *testing.T) {
+	keyin := strings.Split("ab?c\rdef", "")
+	// The first submit fails and moves the cursor to "?"
+	keyin = append(keyin, keys.CtrlJ, keys.CtrlD, keys.CtrlJ)
+
+	count := 0
+	ed := Editor{}
+	ed.Validate = func(lines []string) error {
+		count++
+		for i, s := range lines {
+			if j := strings.Index(s, "?"); j >= 0 {
+				return fmt.Errorf("syntax: %w", &ValidationError{Line: i, Column: j, Message: "unexpected ?"})
+			}
+		}
+		return nil
+	}
+	ed.LineEditor.Tty = &auto.Pilot{Text: keyin}
+	ed.SetWriter(io.Discard)
+	lines, err := ed.Read(context.Background())
+	if err != nil {
+		t.Fatal(err.Error())
+	}
+	if result := strings.Join(lines, "\n"); result != "abc\ndef" {
+		t.Fatalf("expect %#v, but %#v", "abc\ndef", result)
+	}
+	if count != 2 {
+		t.Fatalf("Validate is called %d times", count)
+	}
+}
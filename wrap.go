@@ -0,0 +1,134 @@
+package multiline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/mattn/go-runewidth"
+)
+
+const defaultWrapMarker = "\\"
+
+func (m *Editor) wrapMarker() string {
+	if m.WrapMarker == "" {
+		return defaultWrapMarker
+	}
+	return m.WrapMarker
+}
+
+// tabWidth is the interval of the tab stops. It is the same as the one
+// of go-readline-ny which prints the cursor line.
+const tabWidth = 4
+
+// charWidth returns the width of c printed at the column w
+// when the text of the line starts at the column w0.
+func (m *Editor) charWidth(c rune, w, w0 int) int {
+	if c == '\t' {
+		return tabWidth - (w-w0)%tabWidth
+	}
+	if c < 0x20 {
+		return 2
+	}
+	return runewidth.RuneWidth(c)
+}
+
+func (m *Editor) promptWidth(i int) int {
+	var buffer strings.Builder
+	m.writePrompt(&buffer, i)
+	return int(runewidth.StringWidth(cutEscapeSequenceAndOldLine(buffer.String())))
+}
+
+// wraps tells whether the line i is wrapped. The cursor line is not wrapped
+// while it is edited by go-readline-ny which scrolls it horizontally.
+func (m *Editor) wraps(i int) bool {
+	return m.SoftWrap && (i != m.csrline || m.wrapAll)
+}
+
+// rowsOfLine returns the count of the screen rows for the line i.
+func (m *Editor) rowsOfLine(i int) int {
+	if !m.wraps(i) || i >= len(m.lines) {
+		return 1
+	}
+	w0 := m.promptWidth(i)
+	w := w0
+	rows := 1
+	for _, c := range m.lines[i] {
+		size := m.charWidth(c, w, w0)
+		if w+size >= m.viewWidth-forbiddenWidth {
+			rows++
+			w = w0
+			size = m.charWidth(c, w, w0)
+		}
+		w += size
+	}
+	return rows
+}
+
+// moveWrappedCursorLine moves the cursor line to csrline with SoftWrap.
+// The old cursor line is wrapped and the new one is not from now, so the lines
+// from the upper of them are printed again. When the headline changes,
+// all lines on the screen are printed again.
+// The cursor of the screen must be on the line `m.csrline`.
+func (m *Editor) moveWrappedCursorLine(csrline int) {
+	old := m.csrline
+	headline := m.headline
+	oldRow := m.cursorRow()
+	oldVisible := m.visibleRows()
+	newRows := m.rowsOfLine(csrline)
+
+	m.csrline = csrline
+	if m.adjustHeadline() != 0 {
+		m.csrline = old
+		m.headline = headline
+		m.relayout(func() { m.csrline = csrline })
+		return
+	}
+	out := m.LineEditor.Out
+	if newRows == 1 && m.rowsOfLine(old) == 1 {
+		// No line changes its rows.
+		if d := m.cursorRow() - oldRow; d > 0 {
+			fmt.Fprintf(out, "\x1B[%dE", d)
+		} else {
+			m.up(-d)
+		}
+		return
+	}
+	first := min(old, csrline)
+	if d := m.rowsBetween(m.headline, first) - oldRow; d > 0 {
+		fmt.Fprintf(out, "\x1B[%dE", d)
+	} else {
+		m.up(-d)
+	}
+	row := m.rowsBetween(m.headline, first) + m.PrintFromLine(first)
+	// Erase the rows left by the lines which used more rows before.
+	for ; row < oldVisible-1; row++ {
+		io.WriteString(out, "\n\x1B[2K")
+	}
+	m.up(row - m.cursorRow())
+}
+
+// rowsBetween returns the count of the screen rows for lines[i:j].
+func (m *Editor) rowsBetween(i, j int) int {
+	if !m.SoftWrap {
+		if j < i {
+			return 0
+		}
+		return j - i
+	}
+	rows := 0
+	for ; i < j; i++ {
+		rows += m.rowsOfLine(i)
+	}
+	return rows
+}
+
+// cursorRow returns the screen row of the cursor line from the headline.
+func (m *Editor) cursorRow() int {
+	return m.rowsBetween(m.headline, m.csrline)
+}
+
+// visibleRows returns the count of the screen rows used by the lines on the screen.
+func (m *Editor) visibleRows() int {
+	return min(m.rowsBetween(m.headline, max(len(m.lines), m.csrline+1)), m.viewHeight)
+}
@@ -0,0 +1,41 @@
+package multiline
+
+import (
+	"fmt"
+	"io"
+	"strings"
+	"testing"
+
+	"github.com/nyaosorg/go-readline-ny/keys"
+)
+
+func TestRowsOfLine(t *testing.T) {
+	ed := Editor{SoftWrap: true, viewWidth: 30, viewHeight: 3}
+	ed.prompt = func(w io.Writer, i int) (int, error) {
+		return fmt.Fprintf(w, "%2d ", i+1)
+	}
+	ed.lines = []string{"short", strings.Repeat("x", 60), "short"}
+	ed.csrline = 2
+	if n := ed.rowsOfLine(1); n != 3 {
+		t.Fatalf("expect 3 rows, but %d", n)
+	}
+	if n := ed.rowsOfLine(2); n != 1 {
+		t.Fatalf("expect 1 row for the cursor line, but %d", n)
+	}
+	if ed.adjustHeadline() <= 0 || ed.headline != 2 {
+		t.Fatalf("expect the headline 2, but %d", ed.headline)
+	}
+}
+
+func TestSoftWrapEditing(t *testing.T) {
+	long := strings.Repeat("abcdefghij", 10)
+	keyin := strings.Split("first\r"+long+"\rlast", "")
+	keyin = append(keyin, keys.Up, keys.CtrlA, keys.Backspace, keys.Down, keys.CtrlA, "!", keys.CtrlJ)
+
+	ed := Editor{SoftWrap: true}
+	result := readWithKeys(t, &ed, keyin)
+	expect := "first" + long + "\n!last"
+	if result != expect {
+		t.Fatalf("expect %#v, but %#v", expect, result)
+	}
+}